@@ -1,9 +1,12 @@
 package aiauth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -40,6 +43,105 @@ func TestStoreReadWrite(t *testing.T) {
 	}
 }
 
+func TestSetProfileMergesOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+
+	s1, _ := NewStore(path)
+	s2, _ := NewStore(path)
+	if err := s1.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// s2 loaded before s1 wrote; its save must not drop anthropic:a.
+	if err := s2.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s3, _ := NewStore(path)
+	profiles := s3.Profiles()
+	if profiles["anthropic:a"] == nil || profiles["anthropic:b"] == nil {
+		t.Fatalf("expected both profiles, got %v", profiles)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, _ := NewStore(path, WithLockTimeout(50*time.Millisecond))
+
+	held, err := acquireFileLock(context.Background(), path+".lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	err = store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "a"})
+	var lockErr *LockTimeoutError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected *LockTimeoutError, got %v", err)
+	}
+}
+
+func TestBackupRotationAndRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, _ := NewStore(path, WithBackups(2))
+
+	for _, key := range []string{"k1", "k2", "k3", "k4"} {
+		if err := store.SetProfile("anthropic:key", &Credential{Type: "api_key", Provider: "anthropic", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := store.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+
+	if err := store.Restore(2); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _ := NewStore(path)
+	if got := reloaded.Profiles()["anthropic:key"].Key; got != "k2" {
+		t.Fatalf("expected k2 after restore, got %s", got)
+	}
+
+	// No temp files left behind.
+	matches, _ := filepath.Glob(path + ".tmp-*")
+	if len(matches) != 0 {
+		t.Fatalf("leftover temp files: %v", matches)
+	}
+}
+
+func TestBookkeepingSkipsBackups(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, _ := NewStore(path, WithBackups(2))
+
+	for _, key := range []string{"k1", "k2"} {
+		if err := store.SetProfile("anthropic:key", &Credential{Type: "api_key", Provider: "anthropic", Key: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.Resolve("anthropic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ReportFailure("anthropic:key", FailureRateLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, _ := store.Backups()
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup, got %d", len(backups))
+	}
+	if err := store.Restore(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Profiles()["anthropic:key"].Key; got != "k1" {
+		t.Fatalf("expected k1 after restore, got %s", got)
+	}
+}
+
 func TestCredentialOrdering(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "auth-profiles.json")
@@ -65,6 +167,312 @@ func TestCredentialOrdering(t *testing.T) {
 	}
 }
 
+func TestLastGoodAndCooldown(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	now := time.Now()
+
+	data := &AuthStore{
+		Version: 1,
+		Profiles: map[string]*Credential{
+			"anthropic:oa":  {Type: "oauth", Provider: "anthropic", Access: "oauth-1", Expires: now.Add(time.Hour).UnixMilli()},
+			"anthropic:b":   {Type: "api_key", Provider: "anthropic", Key: "key-b"},
+			"anthropic:a":   {Type: "api_key", Provider: "anthropic", Key: "key-a"},
+			"anthropic:hot": {Type: "api_key", Provider: "anthropic", Key: "key-hot"},
+		},
+		LastGood: map[string]string{"anthropic": "anthropic:hot"},
+		UsageStats: map[string]*UsageStats{
+			"anthropic:hot": {CooldownUntil: now.Add(time.Minute).UnixMilli()},
+			"anthropic:oa":  {DisabledUntil: now.Add(time.Hour).UnixMilli()},
+		},
+	}
+	raw, _ := json.Marshal(data)
+	os.WriteFile(path, raw, 0600)
+
+	store, _ := NewStore(path)
+	var order []string
+	for _, c := range store.ProfilesForProvider("anthropic") {
+		order = append(order, c.Key+c.Access)
+	}
+	if want := "key-hot oauth-1 key-a key-b"; strings.Join(order, " ") != want {
+		t.Fatalf("unexpected order %v, want %s", order, want)
+	}
+
+	// LastGood and oauth are both cooling down; ties fall back to name order.
+	key, err := store.ResolveKey("anthropic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "key-a" {
+		t.Fatalf("expected key-a, got %s", key)
+	}
+
+	reloaded, _ := NewStore(path)
+	if got := reloaded.data.LastGood["anthropic"]; got != "anthropic:a" {
+		t.Fatalf("expected LastGood to move to anthropic:a, got %s", got)
+	}
+	if reloaded.data.UsageStats["anthropic:a"].LastUsed == 0 {
+		t.Fatal("expected LastUsed to be recorded")
+	}
+}
+
+func TestReportFailureFailsOver(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+	store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+
+	if err := store.ReportFailure("anthropic:a", FailureKindForStatus(429)); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := store.ResolveKey("anthropic"); key != "key-b" {
+		t.Fatalf("expected failover to key-b, got %s", key)
+	}
+
+	// A second rate limit grows the cooldown; billing disables instead.
+	first := store.data.UsageStats["anthropic:a"].CooldownUntil
+	store.ReportFailure("anthropic:a", FailureRateLimit)
+	st := store.data.UsageStats["anthropic:a"]
+	if st.ErrorCount != 2 || st.FailureCounts["rate_limit"] != 2 || st.CooldownUntil-first < (3*time.Minute).Milliseconds() {
+		t.Fatalf("unexpected stats after two rate limits: %+v", st)
+	}
+	store.ReportFailure("anthropic:b", FailureBilling)
+	if st := store.data.UsageStats["anthropic:b"]; st.DisabledUntil == 0 || st.DisabledReason != "billing" {
+		t.Fatalf("expected billing to disable anthropic:b: %+v", st)
+	}
+	if _, err := store.ResolveKey("anthropic"); err == nil {
+		t.Fatal("expected no usable credentials")
+	}
+
+	if err := store.ReportSuccess("anthropic:a"); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := store.ResolveKey("anthropic"); key != "key-a" {
+		t.Fatalf("expected key-a after success, got %s", key)
+	}
+	if st := store.data.UsageStats["anthropic:a"]; st.ErrorCount != 0 || st.FailureCounts != nil {
+		t.Fatalf("expected counters reset: %+v", st)
+	}
+	if err := store.ReportFailure("anthropic:missing", FailureAuth); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("anthropic:oa", &Credential{Type: "oauth", Provider: "anthropic", Access: "sk-ant-oat01-x", Expires: time.Now().Add(time.Hour).UnixMilli(), Email: "a@example.com"})
+	store.SetProfile("anthropic:key", &Credential{Type: "api_key", Provider: "anthropic", Key: "sk-ant-api03-x"})
+
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	res, err := store.Resolve("anthropic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Profile != "anthropic:oa" || res.Source() != "anthropic:oa" || res.Scheme != SchemeBearer || res.Type != "oauth" || res.Email != "a@example.com" {
+		t.Fatalf("unexpected resolution %+v", res)
+	}
+
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-oat01-env")
+	res, _ = store.Resolve("anthropic")
+	if res.EnvVar != "ANTHROPIC_API_KEY" || res.Profile != "" || res.Scheme != SchemeBearer {
+		t.Fatalf("expected bearer env resolution, got %+v", res)
+	}
+	t.Setenv("ANTHROPIC_API_KEY", "sk-ant-api03-env")
+	if res, _ = store.Resolve("anthropic"); res.Scheme != SchemeAPIKey || res.Type != "api_key" {
+		t.Fatalf("expected api key env resolution, got %+v", res)
+	}
+
+	// Alternate env vars are checked in order.
+	t.Setenv("GOOGLE_API_KEY", "")
+	t.Setenv("GEMINI_API_KEY", "gemini-key")
+	if res, err = store.Resolve("google"); err != nil || res.EnvVar != "GEMINI_API_KEY" || res.Secret != "gemini-key" {
+		t.Fatalf("expected GEMINI_API_KEY resolution, got %+v, %v", res, err)
+	}
+	t.Setenv("GOOGLE_API_KEY", "google-key")
+	if res, _ = store.Resolve("google"); res.EnvVar != "GOOGLE_API_KEY" {
+		t.Fatalf("expected GOOGLE_API_KEY to take precedence, got %+v", res)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	store, _ := OpenStore(NewMemoryBackend())
+	past := time.Now().Add(-time.Hour).UnixMilli()
+	store.SetProfile("anthropic:oa", &Credential{Type: "oauth", Provider: "anthropic", Access: "old", Refresh: "r", Expires: past})
+	store.SetProfile("anthropic:tok", &Credential{Type: "token", Provider: "anthropic", Token: "t", Expires: past})
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+	store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+
+	ex, err := store.Explain("anthropic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ANTHROPIC_API_KEY:not set",
+		"anthropic:oa:expired and no provider registered to refresh it",
+		"anthropic:tok:expired",
+		"anthropic:a:",
+		"anthropic:b:lower priority than anthropic:a",
+	}
+	if len(ex.Candidates) != len(want) {
+		t.Fatalf("expected %d candidates, got %+v", len(want), ex.Candidates)
+	}
+	for i, c := range ex.Candidates {
+		if got := c.Source() + ":" + c.Reason; !strings.HasPrefix(got, want[i]) {
+			t.Errorf("candidate %d: got %q, want %q", i, got, want[i])
+		}
+	}
+	if !ex.Candidates[3].Selected || ex.Winner == nil || ex.Winner.Secret != "key-a" {
+		t.Fatalf("expected anthropic:a to win, got %+v", ex.Winner)
+	}
+	if lg := store.data.LastGood["anthropic"]; lg != "" {
+		t.Fatalf("Explain should not record usage, LastGood=%s", lg)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "env-key")
+	profiles := map[string]*Credential{
+		"anthropic:oa":   {Type: "oauth", Provider: "anthropic", Access: "oauth-1", Expires: time.Now().Add(time.Hour).UnixMilli()},
+		"anthropic:ci":   {Type: "api_key", Provider: "anthropic", Key: "key-ci"},
+		"anthropic:work": {Type: "api_key", Provider: "anthropic", Key: "key-work"},
+	}
+	open := func(opts ...StoreOption) *Store {
+		store, err := OpenStore(NewMemoryBackend(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, c := range profiles {
+			store.SetProfile(name, c)
+		}
+		return store
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(cfgPath, []byte(`{"providers": {"anthropic": {"order": ["api_key", "oauth"], "env": "never"}}}`), 0600)
+	t.Setenv(ConfigEnvVar, cfgPath)
+	if key, _ := open().ResolveKey("anthropic"); key != "key-ci" {
+		t.Fatalf("expected api_key preferred and env ignored, got %s", key)
+	}
+
+	// Go options override the file.
+	store := open(WithPolicy("anthropic", Policy{Profiles: []string{"anthropic:work"}, Env: EnvLast}))
+	if key, _ := store.ResolveKey("anthropic"); key != "key-work" {
+		t.Fatalf("expected pinned profile, got %s", key)
+	}
+	store.ReportFailure("anthropic:work", FailureAuth)
+	if key, _ := store.ResolveKey("anthropic"); key != "env-key" {
+		t.Fatalf("expected env var as last resort, got %s", key)
+	}
+	ex, _ := store.Explain("anthropic")
+	if c := ex.Candidates[len(ex.Candidates)-1]; c.Reason != "excluded by policy" {
+		t.Fatalf("expected excluded profiles to be listed, got %+v", c)
+	}
+
+	// Explain still lists the excluded profiles when the policy rules out
+	// every one of them.
+	ex, err := open(WithPolicy("anthropic", Policy{Order: []string{"token"}, Env: EnvNever})).Explain("anthropic")
+	if err == nil || len(ex.Candidates) != 4 || ex.Candidates[3].Reason != "excluded by policy" {
+		t.Fatalf("expected every profile listed as excluded, got %+v, %v", ex.Candidates, err)
+	}
+
+	// Invalid policies are rejected at load time.
+	os.WriteFile(cfgPath, []byte(`{"providers": {"anthropic": {"order": ["password"]}}}`), 0600)
+	if _, err := OpenStore(NewMemoryBackend()); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Fatalf("expected invalid config error, got %v", err)
+	}
+	t.Setenv(ConfigEnvVar, "")
+	if _, err := OpenStore(NewMemoryBackend(), WithPolicy("anthropic", Policy{Env: "sometimes"})); err == nil {
+		t.Fatal("expected invalid policy error")
+	}
+}
+
+func TestProfileCRUD(t *testing.T) {
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+	store.ReportSuccess("anthropic:a")
+	store.ReportFailure("anthropic:a", FailureRateLimit)
+
+	if err := store.AddProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic"}); !errors.Is(err, ErrProfileExists) {
+		t.Fatalf("expected ErrProfileExists, got %v", err)
+	}
+
+	if err := store.RenameProfile("anthropic:a", "anthropic:b"); err != nil {
+		t.Fatal(err)
+	}
+	if store.data.LastGood["anthropic"] != "anthropic:b" || store.Usage("anthropic:b").ErrorCount != 1 || store.data.UsageStats["anthropic:a"] != nil {
+		t.Fatalf("rename did not carry state: lastGood=%v usage=%v", store.data.LastGood, store.data.UsageStats)
+	}
+
+	if err := store.CopyProfile("anthropic:b", "anthropic:c"); err != nil {
+		t.Fatal(err)
+	}
+	if store.Profiles()["anthropic:c"] == store.Profiles()["anthropic:b"] || store.Profiles()["anthropic:c"].Key != "key-a" {
+		t.Fatal("expected an independent copy")
+	}
+	if store.Usage("anthropic:c").ErrorCount != 0 {
+		t.Fatal("copy should start without usage stats")
+	}
+
+	if err := store.DeleteProfile("anthropic:b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.data.LastGood["anthropic"]; ok || store.data.UsageStats["anthropic:b"] != nil {
+		t.Fatalf("delete left state behind: lastGood=%v usage=%v", store.data.LastGood, store.data.UsageStats)
+	}
+	if err := store.DeleteProfile("anthropic:b"); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected ErrProfileNotFound, got %v", err)
+	}
+}
+
+func TestSnapshotsAreIsolated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, _ := NewStore(path)
+	store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+
+	store.Profiles()["anthropic:a"].Key = "mutated"
+	snap := store.ProfilesForProvider("anthropic")
+	snap[0].Key = "mutated"
+	if c, _ := store.Profile("anthropic:a"); c.Key != "key-a" {
+		t.Fatalf("snapshot mutation leaked into the store: %s", c.Key)
+	}
+
+	var names []string
+	for name := range store.All() {
+		names = append(names, name)
+	}
+	if strings.Join(names, " ") != "anthropic:a anthropic:b" {
+		t.Fatalf("unexpected iteration order %v", names)
+	}
+
+	// Names stay valid after a reload replaces the profile map.
+	other, _ := NewStore(path)
+	other.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a2"})
+	store.Reload()
+	if err := store.UpdateProfile(snap[0].Name, &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a3"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := other.Profile("anthropic:a"); c.Key != "key-a2" {
+		t.Fatalf("other store should not see the write before reloading, got %s", c.Key)
+	}
+	other.Reload()
+	if c, _ := other.Profile("anthropic:a"); c.Key != "key-a3" {
+		t.Fatalf("expected key-a3 after reload, got %s", c.Key)
+	}
+
+	// Credentials returned by a refresh are copies too.
+	store.SetProfile("renewing:oauth", &Credential{Type: "oauth", Provider: "renewing", Access: "stale", Refresh: "r1", Expires: 1})
+	refreshed, err := store.RefreshProfileContext(context.Background(), "renewing:oauth", renewingProvider{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed.Access = "mutated"
+	if c, _ := store.Profile("renewing:oauth"); c.Access != "fresh" {
+		t.Fatalf("refresh result mutation leaked into the store: %s", c.Access)
+	}
+}
+
 func TestEnvVarPriority(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "auth-profiles.json")
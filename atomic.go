@@ -0,0 +1,160 @@
+package aiauth
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBackups is the number of previous store generations kept on disk.
+const DefaultBackups = 3
+
+// Backup describes one rotated generation of the store file.
+type Backup struct {
+	Generation int // 1 is the most recent previous version
+	Path       string
+	ModTime    time.Time
+}
+
+// backupPath returns the path of backup generation n for path.
+func backupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// writeFileAtomic writes data to a temp file next to path, fsyncs it and
+// renames it over path, so readers only ever see the old or the new
+// contents. When backups > 0 the previous contents are kept as path.1,
+// older generations shift up and anything beyond path.<backups> is dropped.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, backups int) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() { os.Remove(tmpName) }
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		cleanup()
+		return err
+	}
+
+	if backups > 0 {
+		if err := rotateBackups(path, backups); err != nil {
+			cleanup()
+			return fmt.Errorf("rotate backups: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		cleanup()
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// rotateBackups shifts path.1..path.<n-1> up by one and preserves the
+// current contents of path as path.1. The live file stays in place so there
+// is never a moment where path does not exist.
+func rotateBackups(path string, n int) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	for i := n - 1; i >= 1; i-- {
+		err := os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	first := backupPath(path, 1)
+	if err := os.Remove(first); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, first); err == nil {
+		return nil
+	}
+	// Hard links are not supported everywhere; fall back to a copy.
+	return copyFile(path, first)
+}
+
+// listBackups returns the existing backup generations of path, newest first.
+func listBackups(path string) ([]Backup, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []Backup
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err != nil || n < 1 {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Generation: n, Path: m, ModTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Generation < backups[j].Generation })
+	return backups, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable. Errors are
+// ignored: not every platform supports syncing directories.
+func syncDir(dir string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
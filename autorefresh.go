@@ -0,0 +1,194 @@
+package aiauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// Defaults for AutoRefreshOptions.
+const (
+	DefaultRefreshWindow   = 10 * time.Minute
+	DefaultRefreshInterval = time.Minute
+	DefaultMinBackoff      = 30 * time.Second
+	DefaultMaxBackoff      = 15 * time.Minute
+)
+
+// AutoRefreshOptions configures StartAutoRefresh. Zero values use the
+// Default* constants.
+type AutoRefreshOptions struct {
+	// Window is how long before expiry a token is refreshed.
+	Window time.Duration
+	// Interval is how often profiles are checked.
+	Interval time.Duration
+	// MinBackoff and MaxBackoff bound the exponential delay before retrying
+	// a profile whose refresh failed.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnEvent, if set, is called after every refresh attempt.
+	OnEvent func(RefreshEvent)
+	// Events, if set, receives every refresh attempt. Sends never block; an
+	// event is dropped if the channel is full.
+	Events chan<- RefreshEvent
+}
+
+// RefreshEvent reports the outcome of one background refresh attempt.
+type RefreshEvent struct {
+	Profile  string
+	Provider string
+	Time     time.Time
+	Expires  int64     // new expiry (unix ms) on success
+	Err      error     // nil on success
+	RetryAt  time.Time // when the profile will be retried after a failure
+	Failures int       // consecutive failures, 0 on success
+}
+
+func (o *AutoRefreshOptions) setDefaults() {
+	if o.Window <= 0 {
+		o.Window = DefaultRefreshWindow
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultRefreshInterval
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = DefaultMinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = DefaultMaxBackoff
+		if o.MaxBackoff < o.MinBackoff {
+			o.MaxBackoff = o.MinBackoff
+		}
+	}
+}
+
+// StartAutoRefresh starts a goroutine that refreshes every oauth profile
+// with a registered provider once it is within opts.Window of expiry, so
+// ResolveKey never has to refresh on a caller's request path. Failed
+// profiles are retried with exponential backoff and the outcome is recorded
+// in UsageStats. The goroutine stops when ctx is done.
+func (s *Store) StartAutoRefresh(ctx context.Context, opts AutoRefreshOptions) {
+	opts.setDefaults()
+	go s.autoRefresh(ctx, opts)
+}
+
+type refreshBackoff struct {
+	failures int
+	retryAt  time.Time
+}
+
+func (s *Store) autoRefresh(ctx context.Context, opts AutoRefreshOptions) {
+	backoff := make(map[string]*refreshBackoff)
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.refreshDue(ctx, opts, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshDue refreshes every profile that is inside the window and not
+// backing off.
+func (s *Store) refreshDue(ctx context.Context, opts AutoRefreshOptions, backoff map[string]*refreshBackoff) {
+	// Pick up changes made by other processes first.
+	if err := s.Reload(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	now := time.Now()
+	for _, np := range s.dueProfiles(now.Add(opts.Window)) {
+		if ctx.Err() != nil {
+			return
+		}
+		p, ok := providerRegistry[np.Provider]
+		if !ok {
+			continue
+		}
+		b := backoff[np.Name]
+		if b != nil && now.Before(b.retryAt) {
+			continue
+		}
+
+		refreshed, err := s.refreshShared(ctx, np.Name, p, opts.Window)
+		ev := RefreshEvent{Profile: np.Name, Provider: np.Provider, Time: time.Now(), Err: err}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if b == nil {
+				b = &refreshBackoff{}
+				backoff[np.Name] = b
+			}
+			b.failures++
+			delay := opts.MinBackoff << (b.failures - 1)
+			if delay > opts.MaxBackoff || delay <= 0 {
+				delay = opts.MaxBackoff
+			}
+			b.retryAt = ev.Time.Add(delay)
+			ev.RetryAt, ev.Failures = b.retryAt, b.failures
+		} else {
+			delete(backoff, np.Name)
+			ev.Expires = refreshed.Expires
+		}
+		s.recordRefresh(ctx, np.Name, err)
+		emitRefreshEvent(opts, ev)
+	}
+}
+
+// dueProfiles returns the refreshable profiles that expire before deadline,
+// by name.
+func (s *Store) dueProfiles(deadline time.Time) []NamedCredential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []NamedCredential
+	for name, c := range s.data.Profiles {
+		if !c.refreshable() || c.Expires == 0 {
+			continue
+		}
+		if c.Expires <= deadline.UnixMilli() {
+			due = append(due, NamedCredential{name, *c})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Name < due[j].Name })
+	return due
+}
+
+// recordRefresh stores the outcome of a refresh in the profile's UsageStats.
+// It leaves ErrorCount, which counts API failures, to ReportFailure and
+// ReportSuccess.
+func (s *Store) recordRefresh(ctx context.Context, name string, refreshErr error) {
+	_ = s.update(ctx, func(data *AuthStore) error {
+		if _, ok := data.Profiles[name]; !ok {
+			return errNoChange
+		}
+		st := data.stats(name)
+		if refreshErr != nil {
+			st.RefreshErrors++
+			st.LastRefreshFailureAt = time.Now().UnixMilli()
+			return nil
+		}
+		if st.RefreshErrors == 0 {
+			return errNoChange
+		}
+		st.RefreshErrors = 0
+		return nil
+	})
+}
+
+func emitRefreshEvent(opts AutoRefreshOptions, ev RefreshEvent) {
+	if opts.OnEvent != nil {
+		opts.OnEvent(ev)
+	}
+	if opts.Events != nil {
+		select {
+		case opts.Events <- ev:
+		default:
+		}
+	}
+}
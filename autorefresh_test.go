@@ -0,0 +1,203 @@
+package aiauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyProvider fails its first refresh and succeeds afterwards.
+type flakyProvider struct {
+	calls atomic.Int32
+}
+
+func (p *flakyProvider) ID() string { return "flaky" }
+
+func (p *flakyProvider) LoginContext(ctx context.Context, cb LoginCallbacks) (*Credential, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *flakyProvider) RefreshTokenContext(ctx context.Context, cred *Credential) (*Credential, error) {
+	if p.calls.Add(1) == 1 {
+		return nil, errors.New("token endpoint unavailable")
+	}
+	return &Credential{
+		Type:     "oauth",
+		Provider: "flaky",
+		Access:   "fresh",
+		Refresh:  "refresh-2",
+		Expires:  time.Now().Add(time.Hour).UnixMilli(),
+	}, nil
+}
+
+func TestAutoRefresh(t *testing.T) {
+	p := &flakyProvider{}
+	RegisterContextProvider(p)
+
+	store, _ := OpenStore(NewMemoryBackend())
+	err := store.SetProfile("flaky:oauth", &Credential{
+		Type:     "oauth",
+		Provider: "flaky",
+		Access:   "stale",
+		Refresh:  "refresh-1",
+		Expires:  time.Now().Add(2 * time.Minute).UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An API failure reported by the caller, which refreshing must not clear.
+	if err := store.ReportFailure("flaky:oauth", FailureRateLimit); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan RefreshEvent, 10)
+	store.StartAutoRefresh(ctx, AutoRefreshOptions{
+		Window:     5 * time.Minute,
+		Interval:   10 * time.Millisecond,
+		MinBackoff: 20 * time.Millisecond,
+		Events:     events,
+	})
+
+	first := <-events
+	if first.Err == nil || first.Failures != 1 || first.RetryAt.IsZero() {
+		t.Fatalf("expected a failed first attempt with backoff, got %+v", first)
+	}
+	store.mu.Lock()
+	errCount := store.data.UsageStats["flaky:oauth"].RefreshErrors
+	store.mu.Unlock()
+	if errCount != 1 {
+		t.Fatalf("expected RefreshErrors 1 after failure, got %d", errCount)
+	}
+
+	second := <-events
+	if second.Err != nil {
+		t.Fatalf("expected retry to succeed, got %v", second.Err)
+	}
+	if second.Time.Sub(first.Time) < 20*time.Millisecond {
+		t.Fatal("retry did not wait for the backoff")
+	}
+	cancel()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got := store.data.Profiles["flaky:oauth"].Access; got != "fresh" {
+		t.Fatalf("expected refreshed token, got %q", got)
+	}
+	if st := store.data.UsageStats["flaky:oauth"]; st.RefreshErrors != 0 || st.ErrorCount != 1 {
+		t.Fatalf("expected only RefreshErrors reset after success, got %+v", st)
+	}
+}
+
+// slowProvider blocks each refresh until release is closed.
+type slowProvider struct {
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *slowProvider) ID() string { return "slow" }
+
+func (p *slowProvider) LoginContext(ctx context.Context, cb LoginCallbacks) (*Credential, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *slowProvider) RefreshTokenContext(ctx context.Context, cred *Credential) (*Credential, error) {
+	p.once.Do(func() { close(p.started) })
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &Credential{Type: "oauth", Provider: "slow", Access: "fresh", Expires: time.Now().Add(time.Hour).UnixMilli()}, nil
+}
+
+func TestResolveDuringSlowRefresh(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	p := &slowProvider{started: make(chan struct{}), release: make(chan struct{})}
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("slow:oauth", &Credential{Type: "oauth", Provider: "slow", Access: "stale", Refresh: "r", Expires: time.Now().Add(-time.Minute).UnixMilli()})
+	store.SetProfile("openai:key", &Credential{Type: "api_key", Provider: "openai", Key: "sk-openai"})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := store.RefreshProfileContext(context.Background(), "slow:oauth", p)
+		done <- err
+	}()
+	<-p.started
+
+	// Another provider resolves while the token request is in flight; only
+	// the usage bookkeeping waits, and gives up after markUsedTimeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	start := time.Now()
+	if key, err := store.ResolveKeyContext(ctx, "openai"); err != nil || key != "sk-openai" {
+		t.Fatalf("unexpected resolution %q %v", key, err)
+	}
+	if took := time.Since(start); took > markUsedTimeout+250*time.Millisecond {
+		t.Fatalf("resolution waited %s for the refresh", took)
+	}
+	if got := store.Profiles()["slow:oauth"].Access; got != "stale" {
+		t.Fatalf("expected the old token until the refresh is saved, got %q", got)
+	}
+
+	close(p.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Profiles()["slow:oauth"].Access; got != "fresh" {
+		t.Fatalf("expected the refreshed token, got %q", got)
+	}
+}
+
+// hungProvider is a legacy Provider whose refresh never returns until
+// release is closed.
+type hungProvider struct{ release chan struct{} }
+
+func (p *hungProvider) ID() string { return "hung" }
+
+func (p *hungProvider) Login(cb LoginCallbacks) (*Credential, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *hungProvider) RefreshToken(cred *Credential) (*Credential, error) {
+	<-p.release
+	return nil, errors.New("released")
+}
+
+func TestResolveDuringHungRefresh(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	defer func(d time.Duration) { sharedRefreshTimeout = d }(sharedRefreshTimeout)
+	sharedRefreshTimeout = 500 * time.Millisecond
+	p := &hungProvider{release: make(chan struct{})}
+	defer close(p.release)
+	RegisterProvider(p)
+
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("hung:oauth", &Credential{Type: "oauth", Provider: "hung", Access: "stale", Refresh: "r", Expires: time.Now().Add(-time.Minute).UnixMilli()})
+	store.SetProfile("openai:key", &Credential{Type: "api_key", Provider: "openai", Key: "sk-openai"})
+
+	// The caller gives up on its deadline; the shared refresh carries on.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := store.ResolveKeyContext(ctx, "hung"); err == nil {
+		t.Fatal("expected the hung refresh to fail resolution")
+	}
+
+	// A second provider still resolves within its deadline.
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if key, err := store.ResolveKeyContext(ctx, "openai"); err != nil || key != "sk-openai" {
+		t.Fatalf("unexpected resolution %q %v", key, err)
+	}
+
+	// The shared refresh times out and releases the writer lock.
+	time.Sleep(sharedRefreshTimeout)
+	if err := store.SetProfile("openai:key2", &Credential{Type: "api_key", Provider: "openai", Key: "sk-2"}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+package aiauth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AWS environment variables, as read by the AWS SDKs.
+const (
+	AWSAccessKeyIDEnvVar     = "AWS_ACCESS_KEY_ID"
+	AWSSecretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+	AWSSessionTokenEnvVar    = "AWS_SESSION_TOKEN"
+	AWSProfileEnvVar         = "AWS_PROFILE"
+	AWSRegionEnvVar          = "AWS_REGION"
+	AWSDefaultRegionEnvVar   = "AWS_DEFAULT_REGION"
+	// AWSCredentialsFileEnvVar and AWSConfigFileEnvVar override the shared
+	// file locations under ~/.aws.
+	AWSCredentialsFileEnvVar = "AWS_SHARED_CREDENTIALS_FILE"
+	AWSConfigFileEnvVar      = "AWS_CONFIG_FILE"
+)
+
+// awsProviders are the providers whose requests are signed with AWS SigV4.
+// Instead of an API key env var they read AWS credentials from the
+// environment and the shared credentials file.
+var awsProviders = map[string]bool{
+	"bedrock": true,
+}
+
+// RegisterAWSProvider marks provider as signed with AWS SigV4, so it
+// resolves AWS credentials from the environment and ~/.aws/credentials.
+func RegisterAWSProvider(provider string) {
+	awsProviders[provider] = true
+}
+
+// AWSCredentials are the keys and region a request is signed with.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // for temporary credentials
+	Region          string
+}
+
+// awsResolution builds the Resolution for AWS credentials; the secret is
+// the secret access key, but callers need AWS to sign requests.
+func awsResolution(provider string, creds *AWSCredentials) *Resolution {
+	return &Resolution{
+		Provider: provider,
+		Secret:   creds.SecretAccessKey,
+		Scheme:   SchemeSigV4,
+		Type:     "aws",
+		AWS:      creds,
+	}
+}
+
+// resolveAWSEnv looks for AWS credentials outside the store the way the AWS
+// SDKs do: the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY env vars, then
+// the AWS_PROFILE (or default) profile of the shared credentials file. It
+// returns the resolution, if any, and a Candidate for each source checked.
+func resolveAWSEnv(provider string) (*Resolution, []Candidate) {
+	var cands []Candidate
+	region := awsRegion()
+
+	id, secret := os.Getenv(AWSAccessKeyIDEnvVar), os.Getenv(AWSSecretAccessKeyEnvVar)
+	switch {
+	case id != "" && secret != "":
+		res := awsResolution(provider, &AWSCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: secret,
+			SessionToken:    os.Getenv(AWSSessionTokenEnvVar),
+			Region:          region,
+		})
+		res.EnvVar = AWSAccessKeyIDEnvVar
+		return res, append(cands, Candidate{EnvVar: AWSAccessKeyIDEnvVar, Type: "aws", Selected: true})
+	case id != "":
+		cands = append(cands, Candidate{EnvVar: AWSAccessKeyIDEnvVar, Reason: AWSSecretAccessKeyEnvVar + " not set"})
+	default:
+		cands = append(cands, Candidate{EnvVar: AWSAccessKeyIDEnvVar, Reason: "not set"})
+	}
+
+	path, err := awsSharedFile(AWSCredentialsFileEnvVar, "credentials")
+	if err != nil {
+		return nil, cands
+	}
+	profile := awsProfile()
+	source := fmt.Sprintf("%s [%s]", path, profile)
+	section, err := readAWSSection(path, profile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, append(cands, Candidate{File: source, Reason: "no such file"})
+	case err != nil:
+		return nil, append(cands, Candidate{File: source, Reason: "unreadable", Err: err})
+	case section == nil:
+		return nil, append(cands, Candidate{File: source, Reason: "no such profile"})
+	case section["aws_access_key_id"] == "" || section["aws_secret_access_key"] == "":
+		return nil, append(cands, Candidate{File: source, Reason: "no static keys in profile"})
+	}
+	if r := section["region"]; r != "" && region == "" {
+		region = r
+	}
+	res := awsResolution(provider, &AWSCredentials{
+		AccessKeyID:     section["aws_access_key_id"],
+		SecretAccessKey: section["aws_secret_access_key"],
+		SessionToken:    section["aws_session_token"],
+		Region:          region,
+	})
+	res.File = source
+	return res, append(cands, Candidate{File: source, Type: "aws", Selected: true})
+}
+
+func awsProfile() string {
+	if p := os.Getenv(AWSProfileEnvVar); p != "" {
+		return p
+	}
+	return "default"
+}
+
+// awsRegion returns the region from the env vars, or else from the profile
+// in the shared config file.
+func awsRegion() string {
+	for _, name := range []string{AWSRegionEnvVar, AWSDefaultRegionEnvVar} {
+		if r := os.Getenv(name); r != "" {
+			return r
+		}
+	}
+	path, err := awsSharedFile(AWSConfigFileEnvVar, "config")
+	if err != nil {
+		return ""
+	}
+	// The config file names non-default profiles "profile <name>".
+	profile := awsProfile()
+	if profile != "default" {
+		profile = "profile " + profile
+	}
+	section, _ := readAWSSection(path, profile)
+	return section["region"]
+}
+
+// awsSharedFile returns the path of a shared AWS file: the env var's value,
+// or name under ~/.aws.
+func awsSharedFile(envVar, name string) (string, error) {
+	if p := os.Getenv(envVar); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".aws", name), nil
+}
+
+// readAWSSection returns the keys of one section of an AWS INI file, or nil
+// if the file has no such section.
+func readAWSSection(path, name string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var section map[string]string
+	in := false
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			in = strings.TrimSpace(line[1:len(line)-1]) == name
+			if in && section == nil {
+				section = make(map[string]string)
+			}
+		case in:
+			if k, v, ok := strings.Cut(line, "="); ok {
+				section[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return section, sc.Err()
+}
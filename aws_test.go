@@ -0,0 +1,102 @@
+package aiauth
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Cases from the AWS Signature Version 4 test suite.
+func TestSignSigV4(t *testing.T) {
+	creds := &AWSCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name, method, url, contentType, body, want string
+	}{
+		{"get-vanilla", "GET", "https://example.amazonaws.com/", "", "",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		{"get-vanilla-query-order-key-case", "GET", "https://example.amazonaws.com/?Param2=value2&Param1=value1", "", "",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		{"post-x-www-form-urlencoded", "POST", "https://example.amazonaws.com/", "application/x-www-form-urlencoded", "Param1=value1",
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a"},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		if err := SignSigV4(req, creds, "service", now); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResolveAWS(t *testing.T) {
+	dir := t.TempDir()
+	credsFile := filepath.Join(dir, "credentials")
+	os.WriteFile(credsFile, []byte("[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = default-secret\n\n[work]\n# comment\naws_access_key_id=AKIDWORK\naws_secret_access_key=work-secret\naws_session_token=work-session\n"), 0600)
+	configFile := filepath.Join(dir, "config")
+	os.WriteFile(configFile, []byte("[default]\nregion = us-east-1\n[profile work]\nregion = eu-west-1\n"), 0600)
+	for _, name := range []string{AWSAccessKeyIDEnvVar, AWSSecretAccessKeyEnvVar, AWSSessionTokenEnvVar, AWSRegionEnvVar, AWSDefaultRegionEnvVar} {
+		t.Setenv(name, "")
+	}
+	t.Setenv(AWSCredentialsFileEnvVar, credsFile)
+	t.Setenv(AWSConfigFileEnvVar, configFile)
+	t.Setenv(AWSProfileEnvVar, "work")
+
+	store, _ := OpenStore(NewMemoryBackend(), WithPolicy("bedrock", Policy{Env: EnvLast}))
+	res, err := store.Resolve("bedrock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Scheme != SchemeSigV4 || res.AWS.AccessKeyID != "AKIDWORK" || res.AWS.SessionToken != "work-session" ||
+		res.AWS.Region != "eu-west-1" || res.Source() != credsFile+" [work]" {
+		t.Fatalf("unexpected shared-file resolution %+v %+v", res, res.AWS)
+	}
+
+	t.Setenv(AWSAccessKeyIDEnvVar, "AKIDENV")
+	t.Setenv(AWSSecretAccessKeyEnvVar, "env-secret")
+	t.Setenv(AWSRegionEnvVar, "us-west-2")
+	if res, _ = store.Resolve("bedrock"); res.EnvVar != AWSAccessKeyIDEnvVar || res.AWS.AccessKeyID != "AKIDENV" || res.AWS.Region != "us-west-2" {
+		t.Fatalf("expected env resolution, got %+v %+v", res, res.AWS)
+	}
+
+	// The store profile wins since the policy tries the environment last, and
+	// signs requests through SigV4Transport.
+	store.SetProfile("bedrock:prod", &Credential{Type: "aws", Provider: "bedrock", AccessKeyID: "AKIDSTORE", SecretAccessKey: "store-secret", SessionToken: "tok", Region: "us-east-2"})
+	var got *http.Request
+	client := &http.Client{Transport: &SigV4Transport{Store: store, Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r
+		return &http.Response{StatusCode: 200, Body: http.NoBody, Request: r}, nil
+	})}}
+	resp, err := client.Post("https://bedrock-runtime.us-east-2.amazonaws.com/model/anthropic.claude-v2%3A1/invoke", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth := got.Header.Get("Authorization"); !strings.Contains(auth, "Credential=AKIDSTORE/") || !strings.Contains(auth, "/us-east-2/bedrock/aws4_request") {
+		t.Fatalf("unexpected Authorization %q", auth)
+	}
+	if got.Header.Get("X-Amz-Security-Token") != "tok" {
+		t.Fatal("expected the session token to be sent")
+	}
+
+	// A profile without a region falls back to the environment's.
+	store.SetProfile("bedrock:prod", &Credential{Type: "aws", Provider: "bedrock", AccessKeyID: "AKIDSTORE", SecretAccessKey: "store-secret"})
+	if res, _ = store.Resolve("bedrock"); res.AWS == nil || res.AWS.AccessKeyID != "AKIDSTORE" || res.AWS.Region != "us-west-2" {
+		t.Fatalf("expected the env region for the store profile, got %+v %+v", res, res.AWS)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
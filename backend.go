@@ -0,0 +1,38 @@
+package aiauth
+
+import (
+	"context"
+	"time"
+)
+
+// Backend persists the serialized store document. Store handles parsing,
+// encryption and merging; a backend only has to move bytes and provide a
+// lock that is exclusive across every process sharing the same storage.
+type Backend interface {
+	// Load returns the stored document, or an error matching os.ErrNotExist
+	// if nothing has been saved yet.
+	Load() ([]byte, error)
+	// Save replaces the stored document.
+	Save(data []byte) error
+	// Lock takes the exclusive write lock, waiting up to timeout. It fails
+	// with a *LockTimeoutError if the lock stays held.
+	Lock(ctx context.Context, timeout time.Duration) (unlock func() error, err error)
+	// Watch calls fn whenever the stored document may have changed. It
+	// blocks until ctx is done.
+	Watch(ctx context.Context, fn func()) error
+}
+
+// BackupBackend is implemented by backends that keep previous generations
+// of the document.
+type BackupBackend interface {
+	// Backups lists the available generations, newest first.
+	Backups() ([]Backup, error)
+	// LoadBackup returns generation n (1 = most recent).
+	LoadBackup(n int) ([]byte, error)
+	// RemoveBackups deletes every stored generation.
+	RemoveBackups() error
+	// SaveWithoutBackup replaces the stored document like Save, but
+	// without keeping the previous one as a backup. The store uses it for
+	// writes that only update usage bookkeeping.
+	SaveWithoutBackup(data []byte) error
+}
@@ -0,0 +1,169 @@
+// Package sqlite provides an aiauth.Backend that keeps the auth store in a
+// SQLite database, so several services can share one credential database.
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DefaultLease bounds how long a crashed lock holder can block others.
+	DefaultLease = 2 * time.Minute
+	// DefaultPollInterval is how often Watch checks for a new version.
+	DefaultPollInterval = time.Second
+
+	lockPollInterval = 25 * time.Millisecond
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS aiauth_store (
+	id         INTEGER PRIMARY KEY CHECK (id = 1),
+	data       BLOB    NOT NULL,
+	version    INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS aiauth_lock (
+	id         INTEGER PRIMARY KEY CHECK (id = 1),
+	owner      TEXT    NOT NULL,
+	expires_at INTEGER NOT NULL
+);`
+
+// Backend stores the auth document in a single row and implements the
+// store lock as a lease row, so it works for every process that can open
+// the database.
+type Backend struct {
+	db           *sql.DB
+	name         string
+	Lease        time.Duration
+	PollInterval time.Duration
+}
+
+// Open opens (creating if needed) the SQLite database at path.
+func Open(path string) (*Backend, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	b, err := New(db, path)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// New wraps an existing database handle; name is used in error messages.
+func New(db *sql.DB, name string) (*Backend, error) {
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+	return &Backend{db: db, name: name, Lease: DefaultLease, PollInterval: DefaultPollInterval}, nil
+}
+
+// Close closes the underlying database.
+func (b *Backend) Close() error { return b.db.Close() }
+
+// Load returns the stored document.
+func (b *Backend) Load() ([]byte, error) {
+	var data []byte
+	err := b.db.QueryRow(`SELECT data FROM aiauth_store WHERE id = 1`).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	}
+	return data, err
+}
+
+// Save replaces the stored document and bumps its version.
+func (b *Backend) Save(data []byte) error {
+	_, err := b.db.Exec(`
+		INSERT INTO aiauth_store (id, data, version, updated_at) VALUES (1, ?, 1, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			data = excluded.data,
+			version = aiauth_store.version + 1,
+			updated_at = excluded.updated_at`,
+		data, time.Now().UnixMilli())
+	return err
+}
+
+// Lock takes the lease row. A lease left behind by a crashed process is
+// taken over once it expires.
+func (b *Backend) Lock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	owner, err := newOwner()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now().UnixMilli()
+		res, err := b.db.ExecContext(ctx, `
+			INSERT INTO aiauth_lock (id, owner, expires_at) VALUES (1, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				owner = excluded.owner,
+				expires_at = excluded.expires_at
+			WHERE aiauth_lock.expires_at < ?`,
+			owner, now+b.Lease.Milliseconds(), now)
+		if err != nil {
+			return nil, fmt.Errorf("lock %s: %w", b.name, err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return func() error {
+				_, err := b.db.Exec(`DELETE FROM aiauth_lock WHERE id = 1 AND owner = ?`, owner)
+				return err
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, &aiauth.LockTimeoutError{Path: b.name, Timeout: timeout}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Watch polls the document version and calls fn when it changes.
+func (b *Backend) Watch(ctx context.Context, fn func()) error {
+	interval := b.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	last := b.version()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if cur := b.version(); cur != last {
+				last = cur
+				fn()
+			}
+		}
+	}
+}
+
+func (b *Backend) version() int64 {
+	var v int64
+	_ = b.db.QueryRow(`SELECT version FROM aiauth_store WHERE id = 1`).Scan(&v)
+	return v
+}
+
+func newOwner() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
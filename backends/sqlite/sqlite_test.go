@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func TestSharedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+
+	b1, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b1.Close()
+	b2, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+
+	s1, err := aiauth.OpenStore(b1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := aiauth.OpenStore(b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s1.SetProfile("anthropic:a", &aiauth.Credential{Type: "api_key", Provider: "anthropic", Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.SetProfile("anthropic:b", &aiauth.Credential{Type: "api_key", Provider: "anthropic", Key: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	profiles := s1.Profiles()
+	if profiles["anthropic:a"] == nil || profiles["anthropic:b"] == nil {
+		t.Fatalf("expected both profiles, got %v", profiles)
+	}
+}
+
+func TestLockContention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.db")
+	b1, _ := Open(path)
+	defer b1.Close()
+	b2, _ := Open(path)
+	defer b2.Close()
+
+	unlock, err := b1.Lock(context.Background(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b2.Lock(context.Background(), 50*time.Millisecond)
+	var lockErr *aiauth.LockTimeoutError
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected *LockTimeoutError, got %v", err)
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	unlock2, err := b2.Lock(context.Background(), time.Second)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	unlock2()
+}
@@ -1,8 +1,6 @@
 package aiauth
 
 import (
-	"strings"
-
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
@@ -11,12 +9,17 @@ import (
 // OAuth tokens (sk-ant-oat01-*) use Bearer auth with required beta headers.
 // API keys (sk-ant-api03-*) use x-api-key header.
 func (s *Store) AnthropicClient() (*anthropic.Client, error) {
-	key, err := s.ResolveKey("anthropic")
+	res, err := s.Resolve("anthropic")
 	if err != nil {
 		return nil, err
 	}
+	return AnthropicClientFor(res), nil
+}
 
-	if strings.HasPrefix(key, "sk-ant-oat01-") {
+// AnthropicClientFor returns an *anthropic.Client authenticated with res.
+func AnthropicClientFor(res *Resolution) *anthropic.Client {
+	key := res.Secret
+	if res.Scheme == SchemeBearer {
 		// OAuth tokens require Bearer auth + beta headers.
 		// Explicitly clear apiKey to prevent SDK's DefaultClientOptions from
 		// also sending x-api-key (which the server would treat as a no-credits API key).
@@ -27,12 +30,12 @@ func (s *Store) AnthropicClient() (*anthropic.Client, error) {
 			option.WithHeader("user-agent", "claude-cli/2.1.44 (external, cli)"),
 			option.WithHeader("x-app", "cli"),
 		)
-		return &c, nil
+		return &c
 	}
 
 	c := anthropic.NewClient(
 		option.WithAPIKey(key),
 		option.WithHeader("anthropic-beta", "prompt-caching-2024-07-31"),
 	)
-	return &c, nil
+	return &c
 }
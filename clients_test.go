@@ -30,20 +30,20 @@ func TestAnthropicClient_BetaHeaders(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			store := &Store{
-				data: &AuthStore{
-					Version: 1,
-					Profiles: map[string]*Credential{
-						"anthropic": {
-							Type:     tt.credType,
-							Provider: "anthropic",
-							Key:      "sk-ant-api03-test",
-							Access:   "sk-ant-oat01-test",
-							Refresh:  "refresh_test",
-							Expires:  time.Now().Add(1 * time.Hour).UnixMilli(),
-						},
-					},
-				},
+			store, err := OpenStore(NewMemoryBackend())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = store.SetProfile("anthropic", &Credential{
+				Type:     tt.credType,
+				Provider: "anthropic",
+				Key:      "sk-ant-api03-test",
+				Access:   "sk-ant-oat01-test",
+				Refresh:  "refresh_test",
+				Expires:  time.Now().Add(1 * time.Hour).UnixMilli(),
+			})
+			if err != nil {
+				t.Fatal(err)
 			}
 
 			client, err := store.AnthropicClient()
@@ -1,45 +1,124 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/kayushkin/aiauth"
+	"github.com/kayushkin/aiauth/keyring"
 	"github.com/kayushkin/aiauth/providers"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
+// agent is the --agent flag shared by every command.
+var agent string
+
+// openStore returns the --agent store, or the discovered default store.
+// An encrypted store with no key configured prompts for its passphrase.
+func openStore(opts ...aiauth.StoreOption) (*aiauth.Store, error) {
+	store, err := openStoreWith(opts)
+	if errors.Is(err, aiauth.ErrKeyRequired) {
+		pass, perr := passphrase(false)
+		if perr != nil {
+			return nil, err
+		}
+		store, err = openStoreWith(append(opts, aiauth.WithPassphrase(pass)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d := store.Discovery(); d != nil && d.ProjectErr != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring project file: %v\n", d.ProjectErr)
+	}
+	return store, nil
+}
+
+func openStoreWith(opts []aiauth.StoreOption) (*aiauth.Store, error) {
+	if agent != "" {
+		return aiauth.OpenClawStore(agent, opts...)
+	}
+	return aiauth.OpenDefaultStore(opts...)
+}
+
 func main() {
+	// Selectable with AIAUTH_SECRET_BACKEND=secret-service.
+	keyring.Register()
+
 	root := &cobra.Command{
 		Use:   "aiauth",
 		Short: "LLM provider auth management",
 	}
 
-	root.AddCommand(loginCmd(), statusCmd(), keyCmd(), refreshCmd())
+	root.PersistentFlags().StringVar(&agent, "agent", "", "use this OpenClaw agent's store instead of discovering one")
+	root.AddCommand(loginCmd(), statusCmd(), keyCmd(), explainCmd(), refreshCmd(), restoreCmd(), encryptCmd(), decryptCmd(),
+		agentsCmd(), syncCmd(), profileCmd(), doctorCmd())
 
-	if err := root.Execute(); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := root.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// oauthProvider returns the login and refresh implementation for a
+// provider: OAuth, a service-account key for vertex, or an Entra ID app's
+// client credentials for azure.
+func oauthProvider(name string) (aiauth.ContextProvider, error) {
+	switch name {
+	case "anthropic":
+		return providers.NewAnthropic(), nil
+	case "openai":
+		return providers.NewOpenAI(), nil
+	case "google":
+		return providers.NewGoogle(), nil
+	case "vertex":
+		return providers.NewVertex(), nil
+	case "azure":
+		return providers.NewAzure(), nil
+	}
+	return nil, fmt.Errorf("unsupported provider: %s", name)
+}
+
+// registerProviders registers every OAuth provider for automatic refresh.
+func registerProviders() {
+	for _, name := range []string{"anthropic", "openai", "google", "vertex", "azure"} {
+		p, _ := oauthProvider(name)
+		aiauth.RegisterContextProvider(p)
+	}
+}
+
 func loginCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "login [provider]",
-		Short: "Authenticate with a provider via OAuth",
+		Short: "Authenticate with a provider via OAuth (vertex: a service-account key; azure: client credentials)",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			provider := args[0]
-			if provider != "anthropic" {
-				return fmt.Errorf("unsupported provider: %s", provider)
+			p, err := oauthProvider(provider)
+			if err != nil {
+				return err
 			}
 
-			store := aiauth.DefaultStore()
-			ap := providers.NewAnthropic()
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
 
-			cred, err := ap.Login(aiauth.LoginCallbacks{
+			// One reader for every prompt, so piped answers are not lost to
+			// buffering.
+			stdin := bufio.NewReader(os.Stdin)
+			cred, err := p.LoginContext(cmd.Context(), aiauth.LoginCallbacks{
 				OnAuthURL: func(url string) error {
 					fmt.Println("Open this URL in your browser:")
 					fmt.Println(url)
@@ -48,30 +127,37 @@ func loginCmd() *cobra.Command {
 				},
 				OnPrompt: func(message string) (string, error) {
 					fmt.Print(message + " ")
-					var code string
-					_, err := fmt.Scanln(&code)
-					return code, err
+					line, err := stdin.ReadString('\n')
+					if err != nil && line == "" {
+						return "", err
+					}
+					return strings.TrimSpace(line), nil
 				},
 			})
 			if err != nil {
 				return err
 			}
 
-			// Save as oauth profile (canonical)
-			if err := store.SetProfile("anthropic:oauth", cred); err != nil {
-				return fmt.Errorf("failed to save oauth profile: %w", err)
+			// Save as <provider>:oauth (canonical), or <provider>:<type> for
+			// service_account and client_credentials
+			if err := store.SetProfile(provider+":"+cred.Type, cred); err != nil {
+				return fmt.Errorf("failed to save %s profile: %w", cred.Type, err)
+			}
+			if provider != "anthropic" {
+				fmt.Println("✓ Logged in successfully")
+				return nil
 			}
 
 			// Also update anthropic:manual (token type) for OpenClaw compatibility.
-			// OpenClaw's lastGood often points to anthropic:manual, so keep it fresh.
-			manualCred := &aiauth.Credential{
-				Type:     "token",
-				Provider: "anthropic",
-				Token:    cred.Access,
-				Expires:  cred.Expires,
-				Email:    cred.Email,
-			}
-			if err := store.SetProfile("anthropic:manual", manualCred); err != nil {
+			// OpenClaw's lastGood often points to anthropic:manual, so keep it fresh,
+			// along with anything else OpenClaw recorded on it.
+			var manualCred aiauth.Credential
+			if cur, ok := store.Profile("anthropic:manual"); ok {
+				manualCred = cur.Credential
+			}
+			manualCred.Type, manualCred.Provider = "token", "anthropic"
+			manualCred.Token, manualCred.Expires, manualCred.Email = cred.Access, cred.Expires, cred.Email
+			if err := store.SetProfile("anthropic:manual", &manualCred); err != nil {
 				return fmt.Errorf("failed to save manual profile: %w", err)
 			}
 
@@ -86,13 +172,24 @@ func statusCmd() *cobra.Command {
 		Use:   "status",
 		Short: "Show all configured providers and credential status",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			store := aiauth.DefaultStore()
-			profiles := store.Profiles()
-			if len(profiles) == 0 {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if err := store.SecretBackendErr(); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: secret backend unavailable, keeping secrets in the file: %v\n", err)
+			}
+			if d := store.Discovery(); d != nil {
+				fmt.Printf("store: %s (%s)\n", d.Path, describeLayer(d))
+				for provider, profile := range d.Profiles {
+					fmt.Printf("pinned: %s → %s\n", provider, profile)
+				}
+			}
+			if len(store.Snapshot()) == 0 {
 				fmt.Println("No credentials configured.")
 				return nil
 			}
-			for name, c := range profiles {
+			for name, c := range store.All() {
 				status := "valid"
 				masked := ""
 				switch c.Type {
@@ -106,6 +203,13 @@ func statusCmd() *cobra.Command {
 					if c.Expires > 0 && c.Expires < time.Now().UnixMilli() {
 						status = "expired"
 					}
+				case "service_account", "client_credentials":
+					masked = aiauth.MaskKey(c.Access)
+				case "aws":
+					masked = c.AccessKeyID
+					if c.Expires > 0 && c.Expires < time.Now().UnixMilli() {
+						status = "expired"
+					}
 				case "api_key":
 					masked = aiauth.MaskKey(c.Key)
 				}
@@ -117,22 +221,85 @@ func statusCmd() *cobra.Command {
 	}
 }
 
+// describeLayer says which discovery layer chose the store.
+func describeLayer(d *aiauth.Discovery) string {
+	switch d.Layer {
+	case aiauth.LayerEnv:
+		return "from $" + aiauth.StoreEnvVar
+	case aiauth.LayerProject:
+		return "from " + d.ProjectFile
+	default:
+		if d.ProjectFile != "" {
+			return "user default; profiles pinned by " + d.ProjectFile
+		}
+		return "user default"
+	}
+}
+
 func keyCmd() *cobra.Command {
-	return &cobra.Command{
+	var verbose bool
+	cmd := &cobra.Command{
 		Use:   "key [provider]",
 		Short: "Print resolved API key to stdout",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			aiauth.RegisterProvider(&providers.Anthropic{})
-			store := aiauth.DefaultStore()
-			key, err := store.ResolveKey(args[0])
+			registerProviders()
+			store, err := openStore()
 			if err != nil {
 				return err
 			}
-			fmt.Print(key)
+			res, err := store.ResolveContext(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if verbose {
+				expires := "never"
+				if res.Expires > 0 {
+					expires = time.UnixMilli(res.Expires).Format(time.RFC3339)
+				}
+				fmt.Fprintf(os.Stderr, "source=%s  type=%s  scheme=%s  expires=%s  email=%s\n",
+					res.Source(), res.Type, res.Scheme, expires, res.Email)
+			}
+			fmt.Print(res.Secret)
 			return nil
 		},
 	}
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "describe the resolved credential on stderr")
+	return cmd
+}
+
+func explainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "explain [provider]",
+		Short: "Show every credential considered for a provider and why each was skipped",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registerProviders()
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			ex, err := store.ExplainContext(cmd.Context(), args[0])
+			for _, c := range ex.Candidates {
+				kind := c.Type
+				switch {
+				case c.EnvVar != "":
+					kind = "env"
+				case c.File != "":
+					kind = "file"
+				}
+				switch {
+				case c.Selected:
+					fmt.Printf("✓ %-25s  %-7s  selected\n", c.Source(), kind)
+				case c.Err != nil:
+					fmt.Printf("  %-25s  %-7s  skipped: %s: %v\n", c.Source(), kind, c.Reason, c.Err)
+				default:
+					fmt.Printf("  %-25s  %-7s  skipped: %s\n", c.Source(), kind, c.Reason)
+				}
+			}
+			return err
+		},
+	}
 }
 
 func refreshCmd() *cobra.Command {
@@ -142,45 +309,320 @@ func refreshCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			provider := args[0]
-			if provider != "anthropic" {
-				return fmt.Errorf("unsupported provider: %s", provider)
+			p, err := oauthProvider(provider)
+			if err != nil {
+				return err
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			for _, c := range store.ProfilesForProvider(provider) {
+				if c.Type != "oauth" && c.Type != "service_account" && c.Type != "client_credentials" {
+					continue
+				}
+				// RefreshProfile holds the store lock for the whole exchange and
+				// also syncs anthropic:manual for OpenClaw compatibility.
+				if _, err := store.RefreshProfileContext(cmd.Context(), c.Name, p); err != nil {
+					return fmt.Errorf("refresh failed: %w", err)
+				}
+
+				fmt.Println("✓ Token refreshed successfully")
+				return nil
+			}
+			return fmt.Errorf("no OAuth, service account or client credentials found for %s", provider)
+		},
+	}
+}
+
+func restoreCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore [generation]",
+		Short: "Roll auth-profiles.json back to a previous backup (lists backups without an argument)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				backups, err := store.Backups()
+				if err != nil {
+					return err
+				}
+				if len(backups) == 0 {
+					fmt.Println("No backups found.")
+					return nil
+				}
+				for _, b := range backups {
+					fmt.Printf("%-3d  %s  %s\n", b.Generation, b.ModTime.Format(time.RFC3339), b.Path)
+				}
+				return nil
+			}
+
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid generation %q", args[0])
+			}
+			if err := store.Restore(n); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Restored backup %d\n", n)
+			return nil
+		},
+	}
+}
+
+func encryptCmd() *cobra.Command {
+	var keyFile string
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt secrets in auth-profiles.json with a passphrase or key file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if store.Encrypted() {
+				return fmt.Errorf("store is already encrypted")
 			}
 
-			store := aiauth.DefaultStore()
-			creds := store.ProfilesForProvider(provider)
+			src := aiauth.KeySource{KeyFile: keyFile}
+			if keyFile == "" {
+				pass, err := passphrase(true)
+				if err != nil {
+					return err
+				}
+				src.Passphrase = pass
+			}
+			if err := store.Encrypt(src); err != nil {
+				return err
+			}
+			fmt.Println("✓ Store encrypted")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "derive the key from this file instead of a passphrase")
+	return cmd
+}
 
-			for _, c := range creds {
-				if c.Type != "oauth" {
+func decryptCmd() *cobra.Command {
+	var keyFile string
+	cmd := &cobra.Command{
+		Use:   "decrypt",
+		Short: "Convert an encrypted auth-profiles.json back to plaintext",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var opt aiauth.StoreOption
+			if keyFile != "" {
+				opt = aiauth.WithKeyFile(keyFile)
+			} else {
+				pass, err := passphrase(false)
+				if err != nil {
+					return err
+				}
+				opt = aiauth.WithPassphrase(pass)
+			}
+
+			store, err := openStore(opt)
+			if err != nil {
+				return err
+			}
+			if err := store.Decrypt(); err != nil {
+				return err
+			}
+			fmt.Println("✓ Store decrypted")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&keyFile, "key-file", "", "key file the store was encrypted with")
+	return cmd
+}
+
+func agentsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "agents",
+		Short: "List OpenClaw agents and their stores",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			agents, err := aiauth.OpenClawAgents()
+			if err != nil {
+				return err
+			}
+			if len(agents) == 0 {
+				fmt.Println("No OpenClaw agents found.")
+				return nil
+			}
+			for _, name := range agents {
+				store, err := aiauth.OpenClawStore(name)
+				if err != nil {
+					fmt.Printf("%-15s  error: %v\n", name, err)
 					continue
 				}
-				ap := providers.NewAnthropic()
-				refreshed, err := ap.RefreshToken(c)
+				fmt.Printf("%-15s  profiles=%-3d  %s\n", name, len(store.Profiles()), store.Path())
+			}
+			return nil
+		},
+	}
+}
+
+func syncCmd() *cobra.Command {
+	var to []string
+	cmd := &cobra.Command{
+		Use:   "sync [provider]",
+		Short: "Copy a provider's credentials from --agent (default main) to the other OpenClaw agents",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			provider := args[0]
+			from := agent
+			if from == "" {
+				from = aiauth.DefaultAgent
+			}
+			src, err := aiauth.OpenClawStore(from)
+			if err != nil {
+				return err
+			}
+			if len(to) == 0 {
+				agents, err := aiauth.OpenClawAgents()
 				if err != nil {
-					return fmt.Errorf("refresh failed: %w", err)
+					return err
 				}
-				name := store.FindProfileName(c)
-				if err := store.UpdateProfile(name, refreshed); err != nil {
-					return fmt.Errorf("failed to save: %w", err)
+				for _, name := range agents {
+					if name != from {
+						to = append(to, name)
+					}
 				}
+			}
+			if len(to) == 0 {
+				return fmt.Errorf("no other agents to sync to")
+			}
 
-				// Also sync to anthropic:manual for OpenClaw compatibility
-				manualCred := &aiauth.Credential{
-					Type:     "token",
-					Provider: "anthropic",
-					Token:    refreshed.Access,
-					Expires:  refreshed.Expires,
-					Email:    refreshed.Email,
+			var failed bool
+			for _, name := range to {
+				changed, err := syncAgent(cmd.Context(), src, name, provider)
+				switch {
+				case err != nil:
+					failed = true
+					fmt.Fprintf(os.Stderr, "%-15s  error: %v\n", name, err)
+				case len(changed) == 0:
+					fmt.Printf("%-15s  up to date\n", name)
+				default:
+					fmt.Printf("%-15s  updated %s\n", name, strings.Join(changed, ", "))
 				}
-				if err := store.UpdateProfile("anthropic:manual", manualCred); err != nil {
-					return fmt.Errorf("failed to sync manual profile: %w", err)
+			}
+			if failed {
+				return fmt.Errorf("sync failed for some agents")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringSliceVar(&to, "to", nil, "agents to sync to (default: all other agents)")
+	return cmd
+}
+
+func syncAgent(ctx context.Context, src *aiauth.Store, name, provider string) ([]string, error) {
+	dst, err := aiauth.OpenClawStore(name)
+	if err != nil {
+		return nil, err
+	}
+	return aiauth.SyncProfiles(ctx, src, dst, provider)
+}
+
+func doctorCmd() *cobra.Command {
+	var fix bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the store for broken profiles and unsafe file permissions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if fix {
+				fixed, err := store.Fix()
+				for _, f := range fixed {
+					fmt.Printf("fixed    %s\n", f)
+				}
+				if err != nil {
+					return err
 				}
+			}
 
-				fmt.Println("✓ Token refreshed successfully")
+			findings := store.Validate()
+			if len(findings) == 0 {
+				fmt.Println("✓ No problems found")
 				return nil
 			}
-			return fmt.Errorf("no OAuth credentials found for %s", provider)
+			var errs, fixable int
+			for _, f := range findings {
+				fmt.Println(f)
+				if f.Severity == aiauth.SeverityError {
+					errs++
+				}
+				if f.Fixable {
+					fixable++
+				}
+			}
+			if fixable > 0 && !fix {
+				fmt.Printf("%d can be fixed with --fix\n", fixable)
+			}
+			if errs > 0 {
+				return fmt.Errorf("%d errors found", errs)
+			}
+			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "repair what can be repaired automatically")
+	return cmd
+}
+
+// passphrase returns $AIAUTH_PASSPHRASE or prompts for one on stdin,
+// asking twice when confirm is set. A terminal does not echo it; piped
+// input is read a line at a time.
+func passphrase(confirm bool) (string, error) {
+	if p := os.Getenv(aiauth.PassphraseEnvVar); p != "" {
+		return p, nil
+	}
+	var read func(prompt string) (string, error)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		read = func(prompt string) (string, error) {
+			fmt.Print(prompt + " ")
+			p, err := term.ReadPassword(fd)
+			fmt.Println()
+			return string(p), err
+		}
+	} else {
+		in := bufio.NewReader(os.Stdin)
+		read = func(prompt string) (string, error) {
+			fmt.Print(prompt + " ")
+			line, err := in.ReadString('\n')
+			if err != nil && line == "" {
+				return "", err
+			}
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+
+	p, err := read("Passphrase:")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("empty passphrase")
+	}
+	if confirm {
+		again, err := read("Repeat passphrase:")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return p, nil
 }
 
 func openBrowser(url string) {
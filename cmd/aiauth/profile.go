@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+	"github.com/kayushkin/aiauth/providers"
+	"github.com/spf13/cobra"
+)
+
+func profileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Add, remove, rename, copy and inspect profiles",
+	}
+	cmd.AddCommand(profileAddCmd(), profileRmCmd(), profileMvCmd(), profileCpCmd(), profileShowCmd())
+	return cmd
+}
+
+func profileAddCmd() *cobra.Command {
+	var (
+		typ, provider, email             string
+		endpoint, deployment, apiVersion string
+		expires                          time.Duration
+		force                            bool
+	)
+	cmd := &cobra.Command{
+		Use:   "add [name]",
+		Short: "Add an api_key, token or service_account profile, reading the secret from stdin",
+		Example: `  printenv OPENAI_KEY | aiauth profile add openai:work
+  aiauth profile add anthropic:manual --type token --expires 8760h < token.txt
+  aiauth profile add vertex:prod --type service_account < key.json
+  printenv AZURE_KEY | aiauth profile add azure:prod --endpoint https://res.openai.azure.com --deployment gpt-4o`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if typ != "api_key" && typ != "token" && typ != "service_account" {
+				return fmt.Errorf("unsupported type %q (want api_key, token or service_account; use login for oauth)", typ)
+			}
+			if provider == "" {
+				p, _, ok := strings.Cut(name, ":")
+				if !ok {
+					return fmt.Errorf("cannot infer provider from %q; use --provider", name)
+				}
+				provider = p
+			}
+
+			raw, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			secret := strings.TrimSpace(string(raw))
+			if secret == "" {
+				return fmt.Errorf("no secret on stdin")
+			}
+
+			cred := &aiauth.Credential{Type: typ, Provider: provider, Email: email}
+			switch typ {
+			case "api_key":
+				cred.Key = secret
+			case "token":
+				cred.Token = secret
+			case "service_account":
+				if cred, err = providers.ServiceAccountCredential([]byte(secret)); err != nil {
+					return err
+				}
+				cred.Provider = provider
+				if email != "" {
+					cred.Email = email
+				}
+			}
+			if expires > 0 {
+				cred.Expires = time.Now().Add(expires).UnixMilli()
+			}
+			cred.Endpoint, cred.Deployment, cred.APIVersion = endpoint, deployment, apiVersion
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if force {
+				err = store.SetProfile(name, cred)
+			} else {
+				err = store.AddProfile(name, cred)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("✓ Added %s\n", name)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&typ, "type", "api_key", "credential type: api_key, token or service_account")
+	cmd.Flags().StringVar(&provider, "provider", "", "provider (default: the part of the name before ':')")
+	cmd.Flags().StringVar(&email, "email", "", "account email to record")
+	cmd.Flags().DurationVar(&expires, "expires", 0, "expire the credential after this long")
+	cmd.Flags().StringVar(&endpoint, "endpoint", "", "resource endpoint, e.g. for azure")
+	cmd.Flags().StringVar(&deployment, "deployment", "", "model deployment name, e.g. for azure")
+	cmd.Flags().StringVar(&apiVersion, "api-version", "", "API version to call the endpoint with")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "overwrite an existing profile")
+	return cmd
+}
+
+func profileRmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm [name]",
+		Short: "Delete a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if err := store.DeleteProfile(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Deleted %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func profileMvCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mv [old] [new]",
+		Short: "Rename a profile",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if err := store.RenameProfile(args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Renamed %s to %s\n", args[0], args[1])
+			return nil
+		},
+	}
+}
+
+func profileCpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cp [src] [dst]",
+		Short: "Copy a profile",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if err := store.CopyProfile(args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Copied %s to %s\n", args[0], args[1])
+			return nil
+		},
+	}
+}
+
+func profileShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show a profile with its secret masked",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			c, ok := store.Profile(args[0])
+			if !ok {
+				return fmt.Errorf("%w: %q", aiauth.ErrProfileNotFound, args[0])
+			}
+			fmt.Printf("name:      %s\n", args[0])
+			fmt.Printf("type:      %s\n", c.Type)
+			fmt.Printf("provider:  %s\n", c.Provider)
+			switch c.Type {
+			case "api_key":
+				fmt.Printf("key:       %s\n", aiauth.MaskKey(c.Key))
+			case "token":
+				fmt.Printf("token:     %s\n", aiauth.MaskKey(c.Token))
+			case "oauth":
+				fmt.Printf("access:    %s\n", aiauth.MaskKey(c.Access))
+				fmt.Printf("refresh:   %s\n", aiauth.MaskKey(c.Refresh))
+			case "service_account":
+				fmt.Printf("access:    %s\n", aiauth.MaskKey(c.Access))
+			case "client_credentials":
+				fmt.Printf("tenant:    %s\n", c.TenantID)
+				if c.AuthorityURL != "" {
+					fmt.Printf("authority: %s\n", c.AuthorityURL)
+				}
+				fmt.Printf("client:    %s\n", c.ClientID)
+				fmt.Printf("secret:    %s\n", aiauth.MaskKey(c.ClientSecret))
+				fmt.Printf("access:    %s\n", aiauth.MaskKey(c.Access))
+			case "aws":
+				fmt.Printf("key id:    %s\n", c.AccessKeyID)
+				fmt.Printf("secret:    %s\n", aiauth.MaskKey(c.SecretAccessKey))
+				if c.SessionToken != "" {
+					fmt.Printf("session:   %s\n", aiauth.MaskKey(c.SessionToken))
+				}
+			}
+			if c.Region != "" {
+				fmt.Printf("region:    %s\n", c.Region)
+			}
+			if c.Endpoint != "" {
+				fmt.Printf("endpoint:  %s\n", c.Endpoint)
+			}
+			if c.Deployment != "" {
+				fmt.Printf("deploy:    %s\n", c.Deployment)
+			}
+			if c.APIVersion != "" {
+				fmt.Printf("api ver:   %s\n", c.APIVersion)
+			}
+			if c.Expires > 0 {
+				fmt.Printf("expires:   %s\n", formatMillis(c.Expires))
+			}
+			if c.Email != "" {
+				fmt.Printf("email:     %s\n", c.Email)
+			}
+			if c.ProjectID != "" {
+				fmt.Printf("project:   %s\n", c.ProjectID)
+			}
+
+			u := store.Usage(args[0])
+			if u.LastUsed > 0 {
+				fmt.Printf("last used: %s\n", formatMillis(u.LastUsed))
+			}
+			if u.ErrorCount > 0 {
+				fmt.Printf("errors:    %d (last %s)\n", u.ErrorCount, formatMillis(u.LastFailureAt))
+			}
+			if u.RefreshErrors > 0 {
+				fmt.Printf("refresh:   %d failed (last %s)\n", u.RefreshErrors, formatMillis(u.LastRefreshFailureAt))
+			}
+			now := time.Now().UnixMilli()
+			if u.CooldownUntil > now {
+				fmt.Printf("cooldown:  until %s\n", formatMillis(u.CooldownUntil))
+			}
+			if u.DisabledUntil > now {
+				fmt.Printf("disabled:  until %s %s\n", formatMillis(u.DisabledUntil), u.DisabledReason)
+			}
+			return nil
+		},
+	}
+}
+
+func formatMillis(ms int64) string {
+	return time.UnixMilli(ms).Format(time.RFC3339)
+}
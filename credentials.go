@@ -2,7 +2,7 @@ package aiauth
 
 // Credential represents authentication credentials for an LLM provider.
 type Credential struct {
-	Type     string `json:"type"`               // "api_key", "token", "oauth"
+	Type     string `json:"type"`               // "api_key", "token", "oauth", "service_account", "client_credentials", "aws"
 	Provider string `json:"provider"`
 	Key      string `json:"key,omitempty"`     // for api_key
 	Token    string `json:"token,omitempty"`   // for token
@@ -10,18 +10,65 @@ type Credential struct {
 	Refresh  string `json:"refresh,omitempty"` // for oauth
 	Expires  int64  `json:"expires,omitempty"` // unix ms for oauth
 	Email    string `json:"email,omitempty"`
+
+	AccountID string `json:"accountId,omitempty"` // provider account, e.g. the ChatGPT account for OpenAI oauth
+	ProjectID string `json:"projectId,omitempty"` // cloud project the credential bills to, e.g. from Google oauth
+
+	// ServiceAccount is the JSON key of a service_account credential. The
+	// access token minted from it is cached in Access and Expires.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+
+	// OAuth2 client of a client_credentials credential, e.g. an Entra ID app
+	// for Azure. The access token it is granted is cached in Access and
+	// Expires.
+	TenantID     string `json:"tenantId,omitempty"`
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	AuthorityURL string `json:"authorityUrl,omitempty"` // token endpoint host if not the provider's default, e.g. a sovereign cloud
+
+	// Deployment metadata for providers that serve models from per-customer
+	// endpoints, e.g. an Azure OpenAI resource.
+	Endpoint   string `json:"endpoint,omitempty"`
+	Deployment string `json:"deployment,omitempty"`
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// AWS keys of an aws credential, signed with SigV4. Expires is set for
+	// temporary credentials with a session token.
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	Region          string `json:"region,omitempty"`
+
+	extra string // unknown JSON fields, kept on round trip
+}
+
+// secretFields returns pointers to the secret fields of c keyed by their
+// JSON name, so they can be sealed or moved out of the store.
+func (c *Credential) secretFields() map[string]*string {
+	return map[string]*string{
+		"key":     &c.Key,
+		"token":   &c.Token,
+		"access":  &c.Access,
+		"refresh": &c.Refresh,
+
+		"serviceAccount":  &c.ServiceAccount,
+		"clientSecret":    &c.ClientSecret,
+		"secretAccessKey": &c.SecretAccessKey,
+		"sessionToken":    &c.SessionToken,
+	}
 }
 
-// credentialPriority returns a sort order (lower = higher priority).
-func credentialPriority(c *Credential) int {
+// refreshable reports whether c's access token can be renewed by its
+// provider: an oauth token with its refresh token, or a token minted again
+// from a service account key or client secret.
+func (c *Credential) refreshable() bool {
 	switch c.Type {
 	case "oauth":
-		return 0
-	case "token":
-		return 1
-	case "api_key":
-		return 2
-	default:
-		return 3
+		return c.Refresh != ""
+	case "service_account":
+		return c.ServiceAccount != ""
+	case "client_credentials":
+		return c.ClientID != "" && c.ClientSecret != ""
 	}
+	return false
 }
@@ -0,0 +1,165 @@
+package aiauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StoreEnvVar names the store file, overriding project and user defaults.
+const StoreEnvVar = "AIAUTH_STORE"
+
+// Project-local override files, looked up from the working directory upwards.
+const (
+	ProjectFile = ".aiauth.json"
+	ProjectDir  = ".aiauth"
+)
+
+// StoreLayer says which layer of the discovery chain chose the store file.
+type StoreLayer string
+
+const (
+	LayerEnv     StoreLayer = "env"     // $AIAUTH_STORE
+	LayerProject StoreLayer = "project" // a .aiauth.json or .aiauth/ file
+	LayerDefault StoreLayer = "default" // the user's OpenClaw store
+)
+
+// ProjectConfig is the content of a .aiauth.json or .aiauth/config.json file.
+type ProjectConfig struct {
+	// Store is the store file to use, relative to the project file's
+	// directory unless absolute or starting with ~/.
+	Store string `json:"store,omitempty"`
+	// Profiles pins providers to a single profile, e.g.
+	// {"anthropic": "anthropic:work"}.
+	Profiles map[string]string `json:"profiles,omitempty"`
+}
+
+// Discovery is the result of walking the store discovery chain.
+type Discovery struct {
+	Path        string            // store file
+	Layer       StoreLayer        // which layer chose Path
+	ProjectFile string            // project file found, if any
+	Profiles    map[string]string // provider → profile pinned by the project file
+	// ProjectErr is why the project file could not be used; discovery then
+	// carries on as if there were none.
+	ProjectErr error
+}
+
+// DefaultStorePath returns the user default store, the auth-profiles.json of
+// OpenClaw's DefaultAgent.
+func DefaultStorePath() (string, error) {
+	return OpenClawStorePath(DefaultAgent)
+}
+
+// Discover walks the discovery chain for a process working in dir:
+// $AIAUTH_STORE, then the nearest .aiauth.json or .aiauth/ in dir or a
+// parent, then DefaultStorePath. Profiles pinned by a project file apply
+// whichever layer chose the store. A project file that cannot be read is
+// reported in ProjectErr and otherwise ignored, so it never overrides
+// $AIAUTH_STORE.
+func Discover(dir string) (*Discovery, error) {
+	d := &Discovery{}
+	if p := os.Getenv(StoreEnvVar); p != "" {
+		d.Path, d.Layer = p, LayerEnv
+	}
+	if dir != "" {
+		file, pc, err := findProject(dir)
+		d.ProjectFile = file
+		switch {
+		case err != nil:
+			d.ProjectErr = err
+		case file != "":
+			d.Profiles = pc.Profiles
+			if pc.Store != "" && d.Path == "" {
+				d.Path, d.Layer = resolveProjectPath(filepath.Dir(file), pc.Store), LayerProject
+			}
+		}
+	}
+
+	if d.Path == "" {
+		p, err := DefaultStorePath()
+		if err != nil {
+			return nil, err
+		}
+		d.Path, d.Layer = p, LayerDefault
+	}
+	return d, nil
+}
+
+// Options returns the store options that apply the discovered profile pins.
+func (d *Discovery) Options() []StoreOption {
+	var opts []StoreOption
+	for provider, profile := range d.Profiles {
+		opts = append(opts, WithProfile(provider, profile))
+	}
+	return opts
+}
+
+// findProject returns the nearest project file at or above dir: either
+// .aiauth.json or .aiauth/config.json. A store at .aiauth/auth-profiles.json
+// is used when the .aiauth/ config names none, or when there is no config.
+func findProject(dir string) (string, *ProjectConfig, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		if file := filepath.Join(dir, ProjectFile); fileExists(file) {
+			pc, err := loadProjectConfig(file)
+			return file, pc, err
+		}
+		projectStore := filepath.Join(dir, ProjectDir, "auth-profiles.json")
+		if file := filepath.Join(dir, ProjectDir, "config.json"); fileExists(file) {
+			pc, err := loadProjectConfig(file)
+			if err == nil && pc.Store == "" && fileExists(projectStore) {
+				pc.Store = "auth-profiles.json"
+			}
+			return file, pc, err
+		}
+		if fileExists(projectStore) {
+			return projectStore, &ProjectConfig{Store: "auth-profiles.json"}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil, nil
+		}
+		dir = parent
+	}
+}
+
+func loadProjectConfig(file string) (*ProjectConfig, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pc ProjectConfig
+	if err := json.Unmarshal(raw, &pc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	for provider, profile := range pc.Profiles {
+		if profile == "" {
+			return nil, fmt.Errorf("%s: empty profile for provider %q", file, provider)
+		}
+	}
+	return &pc, nil
+}
+
+func resolveProjectPath(base, p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(base, p)
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,69 @@
+package aiauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(StoreEnvVar, "")
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	os.MkdirAll(sub, 0700)
+
+	d, err := Discover(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := DefaultStorePath(); d.Layer != LayerDefault || d.Path != want {
+		t.Fatalf("expected user default, got %+v", d)
+	}
+
+	// A .aiauth.json naming only a profile keeps the default store.
+	os.WriteFile(filepath.Join(root, ProjectFile), []byte(`{"profiles": {"anthropic": "anthropic:work"}}`), 0600)
+	d, _ = Discover(sub)
+	if d.Layer != LayerDefault || d.ProjectFile != filepath.Join(root, ProjectFile) || d.Profiles["anthropic"] != "anthropic:work" {
+		t.Fatalf("expected pinned profile on the default store, got %+v", d)
+	}
+
+	// A nearer .aiauth/ with its own store wins, relative to the directory.
+	os.MkdirAll(filepath.Join(root, "a", ProjectDir), 0700)
+	os.WriteFile(filepath.Join(root, "a", ProjectDir, "auth-profiles.json"), []byte(`{"version": 1}`), 0600)
+	d, _ = Discover(sub)
+	if d.Layer != LayerProject || d.Path != filepath.Join(root, "a", ProjectDir, "auth-profiles.json") {
+		t.Fatalf("expected project store, got %+v", d)
+	}
+
+	t.Setenv(StoreEnvVar, "/tmp/explicit.json")
+	d, _ = Discover(sub)
+	if d.Layer != LayerEnv || d.Path != "/tmp/explicit.json" {
+		t.Fatalf("expected env override, got %+v", d)
+	}
+
+	// A malformed project file is reported but does not hide the env store.
+	os.WriteFile(filepath.Join(sub, ProjectFile), []byte("{bad"), 0600)
+	d, err = Discover(sub)
+	if err != nil || d.Layer != LayerEnv || d.Path != "/tmp/explicit.json" || d.ProjectErr == nil {
+		t.Fatalf("expected env store with a project error, got %+v, %v", d, err)
+	}
+}
+
+func TestDefaultStorePinsProjectProfile(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ProjectFile), []byte(`{"store": "creds.json", "profiles": {"anthropic": "anthropic:work"}}`), 0600)
+	t.Chdir(dir)
+
+	store := DefaultStore()
+	if store.Path() != filepath.Join(dir, "creds.json") {
+		t.Fatalf("expected project store, got %s", store.Path())
+	}
+	store.SetProfile("anthropic:oa", &Credential{Type: "oauth", Provider: "anthropic", Access: "oauth-1"})
+	store.SetProfile("anthropic:work", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-work"})
+	if key, _ := store.ResolveKey("anthropic"); key != "key-work" {
+		t.Fatalf("expected pinned profile, got %s", key)
+	}
+}
@@ -0,0 +1,238 @@
+package aiauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// encryptionVersion is the version of the encryption envelope format.
+	encryptionVersion = 1
+
+	// sealedPrefix marks a secret field value that has been encrypted.
+	sealedPrefix = "enc:v1:"
+
+	// checkPlaintext is sealed into the envelope to verify the key on load.
+	checkPlaintext = "aiauth"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// Environment variables consulted when no key source is passed to NewStore.
+const (
+	PassphraseEnvVar = "AIAUTH_PASSPHRASE"
+	KeyFileEnvVar    = "AIAUTH_KEY_FILE"
+)
+
+var (
+	// ErrKeyRequired is returned when loading an encrypted store without a
+	// passphrase or key file.
+	ErrKeyRequired = errors.New("store is encrypted: passphrase or key file required")
+	// ErrWrongKey is returned when the passphrase or key file does not match.
+	ErrWrongKey = errors.New("store is encrypted with a different key")
+)
+
+// Encryption is the envelope header of an encrypted store. Only secret
+// credential fields are sealed; provider, email, expiry and the rest of the
+// metadata stay readable.
+type Encryption struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"` // "scrypt" (passphrase) or "keyfile"
+	Salt    string `json:"salt"`
+	N       int    `json:"n,omitempty"`
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+	Check   string `json:"check"`
+}
+
+// KeySource supplies the secret used to encrypt a store. Exactly one of
+// Passphrase or KeyFile should be set.
+type KeySource struct {
+	Passphrase string
+	KeyFile    string
+}
+
+func (k KeySource) empty() bool { return k.Passphrase == "" && k.KeyFile == "" }
+
+// keySourceFromEnv reads the key source from AIAUTH_PASSPHRASE / AIAUTH_KEY_FILE.
+func keySourceFromEnv() KeySource {
+	return KeySource{
+		Passphrase: os.Getenv(PassphraseEnvVar),
+		KeyFile:    os.Getenv(KeyFileEnvVar),
+	}
+}
+
+// WithPassphrase unlocks (and encrypts) the store with a passphrase.
+func WithPassphrase(passphrase string) StoreOption {
+	return func(s *Store) { s.keySource = KeySource{Passphrase: passphrase} }
+}
+
+// WithKeyFile unlocks (and encrypts) the store with the contents of a key file.
+func WithKeyFile(path string) StoreOption {
+	return func(s *Store) { s.keySource = KeySource{KeyFile: path} }
+}
+
+// newEncryption creates a fresh envelope header and derives its key.
+func newEncryption(src KeySource) (*Encryption, []byte, error) {
+	if src.empty() {
+		return nil, nil, ErrKeyRequired
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	enc := &Encryption{
+		Version: encryptionVersion,
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+	}
+	if src.KeyFile != "" {
+		enc.KDF = "keyfile"
+	} else {
+		enc.KDF = "scrypt"
+		enc.N, enc.R, enc.P = scryptN, scryptR, scryptP
+	}
+	key, err := enc.deriveKey(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	check, err := seal(key, checkPlaintext, "check")
+	if err != nil {
+		return nil, nil, err
+	}
+	enc.Check = check
+	return enc, key, nil
+}
+
+// deriveKey turns a key source into the 256-bit AES key for this envelope.
+func (e *Encryption) deriveKey(src KeySource) ([]byte, error) {
+	if e.Version > encryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %d", e.Version)
+	}
+	salt, err := base64.StdEncoding.DecodeString(e.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	switch e.KDF {
+	case "scrypt":
+		if src.Passphrase == "" {
+			return nil, ErrKeyRequired
+		}
+		return scrypt.Key([]byte(src.Passphrase), salt, e.N, e.R, e.P, 32)
+	case "keyfile":
+		if src.KeyFile == "" {
+			return nil, ErrKeyRequired
+		}
+		material, err := os.ReadFile(src.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read key file: %w", err)
+		}
+		h := sha256.New()
+		h.Write(salt)
+		h.Write(material)
+		return h.Sum(nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported kdf %q", e.KDF)
+	}
+}
+
+// unlock derives the key and verifies it against the envelope's check value.
+func (e *Encryption) unlock(src KeySource) ([]byte, error) {
+	key, err := e.deriveKey(src)
+	if err != nil {
+		return nil, err
+	}
+	if plain, err := open(key, e.Check, "check"); err != nil || plain != checkPlaintext {
+		return nil, ErrWrongKey
+	}
+	return key, nil
+}
+
+// sealProfiles returns a copy of profiles with every secret field encrypted.
+func sealProfiles(key []byte, profiles map[string]*Credential) (map[string]*Credential, error) {
+	out := make(map[string]*Credential, len(profiles))
+	for name, c := range profiles {
+		cp := *c
+		for field, v := range cp.secretFields() {
+			if *v == "" {
+				continue
+			}
+			sealed, err := seal(key, *v, name+"/"+field)
+			if err != nil {
+				return nil, err
+			}
+			*v = sealed
+		}
+		out[name] = &cp
+	}
+	return out, nil
+}
+
+// openProfiles decrypts every sealed secret field in place.
+func openProfiles(key []byte, profiles map[string]*Credential) error {
+	for name, c := range profiles {
+		for field, v := range c.secretFields() {
+			if !strings.HasPrefix(*v, sealedPrefix) {
+				continue
+			}
+			plain, err := open(key, *v, name+"/"+field)
+			if err != nil {
+				return fmt.Errorf("decrypt %s %s: %w", name, field, err)
+			}
+			*v = plain
+		}
+	}
+	return nil
+}
+
+// seal encrypts plaintext with AES-256-GCM. The profile name and field are
+// bound in as additional data so sealed values cannot be swapped around.
+func seal(key []byte, plaintext, aad string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+func open(key []byte, sealed, aad string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("sealed value too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,65 @@
+package aiauth
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	t.Setenv(PassphraseEnvVar, "")
+	t.Setenv(KeyFileEnvVar, "")
+
+	store, _ := NewStore(path)
+	cred := &Credential{Type: "oauth", Provider: "anthropic", Access: "access-secret", Refresh: "refresh-secret", Email: "me@example.com"}
+	if err := store.SetProfile("anthropic:oauth", cred); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Encrypt(KeySource{Passphrase: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("refresh-secret")) || bytes.Contains(raw, []byte("access-secret")) {
+		t.Fatal("secrets stored in plaintext")
+	}
+	if !bytes.Contains(raw, []byte("me@example.com")) {
+		t.Fatal("metadata should stay readable")
+	}
+	if backups, _ := store.Backups(); len(backups) != 0 {
+		t.Fatalf("plaintext backups kept: %v", backups)
+	}
+
+	if _, err := NewStore(path); !errors.Is(err, ErrKeyRequired) {
+		t.Fatalf("expected ErrKeyRequired, got %v", err)
+	}
+	t.Setenv(StoreEnvVar, path)
+	if _, err := OpenDefaultStore(); !errors.Is(err, ErrKeyRequired) {
+		t.Fatalf("expected OpenDefaultStore to report ErrKeyRequired, got %v", err)
+	}
+	if _, err := NewStore(path, WithPassphrase("wrong")); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+
+	unlocked, err := NewStore(path, WithPassphrase("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := unlocked.Profiles()["anthropic:oauth"].Refresh; got != "refresh-secret" {
+		t.Fatalf("unexpected refresh token %q", got)
+	}
+
+	if err := unlocked.Decrypt(); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain.Encrypted() || plain.Profiles()["anthropic:oauth"].Access != "access-secret" {
+		t.Fatal("store not decrypted")
+	}
+}
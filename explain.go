@@ -0,0 +1,48 @@
+package aiauth
+
+import "context"
+
+// Candidate is one credential source considered while resolving a provider.
+type Candidate struct {
+	Profile  string // set for store profiles
+	EnvVar   string // set for env vars
+	File     string // set for shared credential files, as "path [profile]"
+	Type     string
+	Selected bool
+	Reason   string // why it was skipped; empty when selected
+	Err      error  // the refresh error behind a "refresh failed" skip
+}
+
+// Source returns the env var, file or profile name of the candidate.
+func (c *Candidate) Source() string {
+	if c.EnvVar != "" {
+		return c.EnvVar
+	}
+	if c.File != "" {
+		return c.File
+	}
+	return c.Profile
+}
+
+// Explanation is a trace of how a provider's credential is resolved.
+type Explanation struct {
+	Provider   string
+	Candidates []Candidate // in the order they are considered
+	Winner     *Resolution // nil if nothing is usable
+}
+
+// Explain resolves provider like Resolve but records every candidate and why
+// it was skipped. Expired oauth tokens are refreshed as usual so refresh
+// errors are reported, but usage is not recorded. The returned error is the
+// one Resolve would return; the Explanation is always non-nil.
+func (s *Store) Explain(provider string) (*Explanation, error) {
+	return s.ExplainContext(context.Background(), provider)
+}
+
+// ExplainContext is Explain with a context.
+func (s *Store) ExplainContext(ctx context.Context, provider string) (*Explanation, error) {
+	ex := &Explanation{Provider: provider}
+	res, err := s.resolve(ctx, provider, ex)
+	ex.Winner = res
+	return ex, err
+}
@@ -0,0 +1,126 @@
+package aiauth
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval is how often FileBackend.Watch checks for changes when
+// it has to poll.
+const DefaultPollInterval = time.Second
+
+// FileBackend stores the document as a JSON file, written atomically with
+// rotated backups and locked with an flock-based sidecar file.
+type FileBackend struct {
+	Path         string
+	MaxBackups   int           // previous generations to keep as Path.1, Path.2, ...
+	PollInterval time.Duration // for Watch; DefaultPollInterval if zero
+}
+
+// NewFileBackend returns a file backend for path with DefaultBackups.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{Path: path, MaxBackups: DefaultBackups}
+}
+
+// Load reads the store file.
+func (b *FileBackend) Load() ([]byte, error) {
+	return os.ReadFile(b.Path)
+}
+
+// Save atomically replaces the store file, rotating backups.
+func (b *FileBackend) Save(data []byte) error {
+	return writeFileAtomic(b.Path, data, 0600, b.MaxBackups)
+}
+
+// SaveWithoutBackup atomically replaces the store file, leaving the backups
+// as they are.
+func (b *FileBackend) SaveWithoutBackup(data []byte) error {
+	return writeFileAtomic(b.Path, data, 0600, 0)
+}
+
+// Lock takes the advisory lock on Path.lock.
+func (b *FileBackend) Lock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	l, err := acquireFileLock(ctx, b.Path+".lock", timeout)
+	if err != nil {
+		return nil, err
+	}
+	return l.Release, nil
+}
+
+// Watch calls fn when the file's size or modification time changes,
+// including when it is created or removed. Where the platform supports it
+// (inotify on Linux) changes are picked up as they happen; otherwise, or if
+// the directory cannot be watched, the file is polled every PollInterval.
+func (b *FileBackend) Watch(ctx context.Context, fn func()) error {
+	last := b.stamp()
+	check := func() {
+		if cur := b.stamp(); cur != last {
+			last = cur
+			fn()
+		}
+	}
+
+	if events, err := b.notifications(ctx); err == nil {
+		for range events {
+			check()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		// The notification stream failed; fall back to polling.
+	}
+
+	interval := b.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+	exists  bool
+}
+
+func (b *FileBackend) stamp() fileStamp {
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime(), exists: true}
+}
+
+// Backups lists rotated generations of the store file.
+func (b *FileBackend) Backups() ([]Backup, error) {
+	return listBackups(b.Path)
+}
+
+// LoadBackup reads generation n of the store file.
+func (b *FileBackend) LoadBackup(n int) ([]byte, error) {
+	return os.ReadFile(backupPath(b.Path, n))
+}
+
+// RemoveBackups deletes every rotated generation.
+func (b *FileBackend) RemoveBackups() error {
+	backups, err := listBackups(b.Path)
+	if err != nil {
+		return err
+	}
+	for _, bk := range backups {
+		if err := os.Remove(bk.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
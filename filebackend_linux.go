@@ -0,0 +1,61 @@
+//go:build linux
+
+package aiauth
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// notifications watches the store file's directory with inotify, so atomic
+// replacements by rename are seen as well as in-place writes. The returned
+// channel receives a value (coalesced) for every event on the store file and
+// is closed when ctx is done or the watch fails.
+func (b *FileBackend) notifications(ctx context.Context) (<-chan struct{}, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+		syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_ATTRIB
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(b.Path), mask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// A non-blocking fd is handed to the runtime poller, so Close unblocks
+	// a pending Read.
+	f := os.NewFile(uintptr(fd), "inotify")
+	base := []byte(filepath.Base(b.Path))
+
+	events := make(chan struct{}, 1)
+	stop := context.AfterFunc(ctx, func() { f.Close() })
+	go func() {
+		defer close(events)
+		defer stop()
+		defer f.Close()
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				start := off + syscall.SizeofInotifyEvent
+				off = start + int(ev.Len)
+				name := bytes.TrimRight(buf[start:min(off, n)], "\x00")
+				if ev.Mask&syscall.IN_Q_OVERFLOW != 0 || bytes.Equal(name, base) {
+					select {
+					case events <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return events, nil
+}
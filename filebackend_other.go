@@ -0,0 +1,13 @@
+//go:build !linux
+
+package aiauth
+
+import (
+	"context"
+	"errors"
+)
+
+// notifications is unsupported here; FileBackend.Watch polls instead.
+func (b *FileBackend) notifications(ctx context.Context) (<-chan struct{}, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -4,7 +4,12 @@ go 1.24.0
 
 require (
 	github.com/anthropics/anthropic-sdk-go v1.26.0
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/crypto v0.45.0
+	golang.org/x/sync v0.16.0
+	golang.org/x/term v0.37.0
 )
 
 require (
@@ -14,5 +19,5 @@ require (
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/tidwall/sjson v1.2.5 // indirect
-	golang.org/x/sync v0.16.0 // indirect
+	golang.org/x/sys v0.38.0 // indirect
 )
@@ -0,0 +1,115 @@
+package aiauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// FailureKind classifies why an upstream API rejected a credential.
+type FailureKind string
+
+const (
+	FailureAuth      FailureKind = "auth"       // 401/403: revoked or invalid credential
+	FailureRateLimit FailureKind = "rate_limit" // 429: rate or usage limit hit
+	FailureBilling   FailureKind = "billing"    // 402: out of credits or billing problem
+	FailureUnknown   FailureKind = "unknown"
+)
+
+// cooldownPolicy is the exponential cooldown applied for one failure kind:
+// base * factor^(n-1) after the n-th consecutive failure, capped at max.
+type cooldownPolicy struct {
+	base    time.Duration
+	factor  int
+	max     time.Duration
+	disable bool // set DisabledUntil instead of CooldownUntil
+}
+
+var cooldownPolicies = map[FailureKind]cooldownPolicy{
+	FailureRateLimit: {base: time.Minute, factor: 5, max: time.Hour},
+	FailureAuth:      {base: 5 * time.Minute, factor: 2, max: 6 * time.Hour},
+	FailureBilling:   {base: 5 * time.Hour, factor: 2, max: 24 * time.Hour, disable: true},
+	FailureUnknown:   {base: time.Minute, factor: 2, max: 30 * time.Minute},
+}
+
+func (p cooldownPolicy) after(n int) time.Duration {
+	d := p.base
+	for i := 1; i < n && d < p.max; i++ {
+		d *= time.Duration(p.factor)
+	}
+	if d > p.max {
+		d = p.max
+	}
+	return d
+}
+
+// FailureKindForStatus classifies an upstream HTTP status code.
+func FailureKindForStatus(code int) FailureKind {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return FailureAuth
+	case http.StatusTooManyRequests:
+		return FailureRateLimit
+	case http.StatusPaymentRequired:
+		return FailureBilling
+	default:
+		return FailureUnknown
+	}
+}
+
+// ReportFailure records that the upstream API rejected the named profile.
+// The profile is put in an exponentially growing cooldown for its failure
+// kind, during which ResolveKey skips it and fails over to the next
+// credential.
+func (s *Store) ReportFailure(profile string, kind FailureKind) error {
+	policy, ok := cooldownPolicies[kind]
+	if !ok {
+		kind, policy = FailureUnknown, cooldownPolicies[FailureUnknown]
+	}
+	return s.update(context.Background(), func(data *AuthStore) error {
+		if _, ok := data.Profiles[profile]; !ok {
+			return fmt.Errorf("%w: %q", ErrProfileNotFound, profile)
+		}
+		now := time.Now()
+		st := data.stats(profile)
+		if st.FailureCounts == nil {
+			st.FailureCounts = make(map[string]int)
+		}
+		st.FailureCounts[string(kind)]++
+		st.ErrorCount++
+		st.LastFailureAt = now.UnixMilli()
+
+		until := now.Add(policy.after(st.FailureCounts[string(kind)])).UnixMilli()
+		if policy.disable {
+			st.DisabledUntil = max(st.DisabledUntil, until)
+			st.DisabledReason = string(kind)
+		} else {
+			st.CooldownUntil = max(st.CooldownUntil, until)
+		}
+		return nil
+	})
+}
+
+// ReportSuccess records that the named profile worked: its failure counters
+// and cooldowns are cleared and it becomes its provider's LastGood.
+func (s *Store) ReportSuccess(profile string) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		c, ok := data.Profiles[profile]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrProfileNotFound, profile)
+		}
+		st := data.stats(profile)
+		st.ErrorCount = 0
+		st.FailureCounts = nil
+		st.CooldownUntil = 0
+		st.DisabledUntil = 0
+		st.DisabledReason = ""
+		st.LastUsed = time.Now().UnixMilli()
+		if data.LastGood == nil {
+			data.LastGood = make(map[string]string)
+		}
+		data.LastGood[c.Provider] = profile
+		return nil
+	})
+}
@@ -0,0 +1,177 @@
+// Package keyring implements an aiauth.SecretBackend on top of the
+// freedesktop Secret Service D-Bus API (GNOME Keyring, KWallet, KeePassXC).
+package keyring
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/kayushkin/aiauth"
+)
+
+// Name is the AIAUTH_SECRET_BACKEND value that selects this backend.
+const Name = "secret-service"
+
+const (
+	serviceName       = "org.freedesktop.secrets"
+	servicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	defaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+
+	serviceIface    = "org.freedesktop.Secret.Service"
+	collectionIface = "org.freedesktop.Secret.Collection"
+	itemIface       = "org.freedesktop.Secret.Item"
+
+	application = "aiauth"
+)
+
+// ErrLocked is returned when the collection is locked and unlocking it
+// would need an interactive prompt.
+var ErrLocked = errors.New("secret service collection is locked")
+
+// secret mirrors the Secret Service (oayays) struct.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService stores each secret as an item in the default collection,
+// tagged with application=aiauth and key=<key> attributes.
+type SecretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// Register makes the backend selectable with AIAUTH_SECRET_BACKEND=secret-service.
+func Register() {
+	aiauth.RegisterSecretBackend(Name, func() (aiauth.SecretBackend, error) {
+		return Open()
+	})
+}
+
+// Open connects to the Secret Service on the session bus.
+func Open() (*SecretService, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect session bus: %w", err)
+	}
+	return newSecretService(conn)
+}
+
+// OpenAddress connects to the Secret Service on the bus at addr.
+func OpenAddress(addr string) (*SecretService, error) {
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", addr, err)
+	}
+	return newSecretService(conn)
+}
+
+func newSecretService(conn *dbus.Conn) (*SecretService, error) {
+	var out dbus.Variant
+	var session dbus.ObjectPath
+	err := conn.Object(serviceName, servicePath).
+		Call(serviceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&out, &session)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open secret service session: %w", err)
+	}
+	return &SecretService{conn: conn, session: session}, nil
+}
+
+// Close closes the D-Bus connection.
+func (s *SecretService) Close() error { return s.conn.Close() }
+
+// Get returns the secret stored under key.
+func (s *SecretService) Get(key string) (string, error) {
+	item, err := s.find(key)
+	if err != nil {
+		return "", err
+	}
+	var sec secret
+	err = s.conn.Object(serviceName, item).
+		Call(itemIface+".GetSecret", 0, s.session).
+		Store(&sec)
+	if err != nil {
+		return "", fmt.Errorf("get secret: %w", err)
+	}
+	return string(sec.Value), nil
+}
+
+// Set stores secret under key, replacing any existing item.
+func (s *SecretService) Set(key, value string) error {
+	props := map[string]dbus.Variant{
+		itemIface + ".Label":      dbus.MakeVariant("aiauth " + key),
+		itemIface + ".Attributes": dbus.MakeVariant(attributes(key)),
+	}
+	sec := secret{
+		Session:     s.session,
+		Parameters:  []byte{},
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(serviceName, defaultCollection).
+		Call(collectionIface+".CreateItem", 0, props, sec, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("create item: %w", err)
+	}
+	if prompt != "/" {
+		return ErrLocked
+	}
+	return nil
+}
+
+// Delete removes the item stored under key.
+func (s *SecretService) Delete(key string) error {
+	item, err := s.find(key)
+	if err != nil {
+		return err
+	}
+	var prompt dbus.ObjectPath
+	if err := s.conn.Object(serviceName, item).Call(itemIface+".Delete", 0).Store(&prompt); err != nil {
+		return fmt.Errorf("delete item: %w", err)
+	}
+	if prompt != "/" {
+		return ErrLocked
+	}
+	return nil
+}
+
+// find returns the unlocked item for key, unlocking it if that is possible
+// without a prompt.
+func (s *SecretService) find(key string) (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.conn.Object(serviceName, servicePath).
+		Call(serviceIface+".SearchItems", 0, attributes(key)).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return "", fmt.Errorf("search items: %w", err)
+	}
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) == 0 {
+		return "", aiauth.ErrSecretNotFound
+	}
+
+	var prompt dbus.ObjectPath
+	err = s.conn.Object(serviceName, servicePath).
+		Call(serviceIface+".Unlock", 0, locked[:1]).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return "", fmt.Errorf("unlock: %w", err)
+	}
+	if len(unlocked) == 0 {
+		return "", ErrLocked
+	}
+	return unlocked[0], nil
+}
+
+func attributes(key string) map[string]string {
+	return map[string]string{"application": application, "key": key}
+}
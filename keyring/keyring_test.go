@@ -0,0 +1,234 @@
+package keyring
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/kayushkin/aiauth"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%SOCKET%</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`
+
+// startBus runs a private dbus-daemon and returns its address.
+func startBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "bus.conf")
+	conf := strings.ReplaceAll(busConfig, "%SOCKET%", filepath.Join(dir, "bus"))
+	if err := os.WriteFile(cfg, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+cfg, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	addr, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read bus address: %v", err)
+	}
+	return strings.TrimSpace(addr)
+}
+
+// fakeService is a minimal in-memory Secret Service.
+type fakeService struct {
+	mu    sync.Mutex
+	conn  *dbus.Conn
+	next  int
+	items map[dbus.ObjectPath]*fakeItem
+}
+
+type fakeItem struct {
+	svc   *fakeService
+	path  dbus.ObjectPath
+	attrs map[string]string
+	value []byte
+}
+
+func serveFake(t *testing.T, addr string) *fakeService {
+	t.Helper()
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	svc := &fakeService{conn: conn, items: make(map[dbus.ObjectPath]*fakeItem)}
+	if err := conn.Export(svc, servicePath, serviceIface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(&fakeCollection{svc}, defaultCollection, collectionIface); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(serviceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name: %v %v", reply, err)
+	}
+	return svc
+}
+
+func (f *fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (f *fakeService) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []dbus.ObjectPath
+	for path, it := range f.items {
+		if matches(it.attrs, attrs) {
+			found = append(found, path)
+		}
+	}
+	return found, []dbus.ObjectPath{}, nil
+}
+
+func (f *fakeService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, "/", nil
+}
+
+func (f *fakeService) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.items)
+}
+
+type fakeCollection struct{ svc *fakeService }
+
+func (c *fakeCollection) CreateItem(props map[string]dbus.Variant, sec secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f := c.svc
+	attrs, _ := props[itemIface+".Attributes"].Value().(map[string]string)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if replace {
+		for _, it := range f.items {
+			if matches(it.attrs, attrs) {
+				it.value = sec.Value
+				return it.path, "/", nil
+			}
+		}
+	}
+	f.next++
+	it := &fakeItem{svc: f, attrs: attrs, value: sec.Value}
+	it.path = dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", f.next))
+	if err := f.conn.Export(it, it.path, itemIface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	f.items[it.path] = it
+	return it.path, "/", nil
+}
+
+func (i *fakeItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	return secret{Session: session, Parameters: []byte{}, Value: i.value, ContentType: "text/plain"}, nil
+}
+
+func (i *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.svc.mu.Lock()
+	defer i.svc.mu.Unlock()
+	delete(i.svc.items, i.path)
+	i.svc.conn.Export(nil, i.path, itemIface)
+	return "/", nil
+}
+
+func matches(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreSecretsInSecretService(t *testing.T) {
+	addr := startBus(t)
+	fake := serveFake(t, addr)
+
+	ss, err := OpenAddress(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ss.Close()
+
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, err := aiauth.NewStore(path, aiauth.WithSecretBackend(ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := &aiauth.Credential{Type: "oauth", Provider: "anthropic", Access: "access-secret", Refresh: "refresh-secret", Email: "me@example.com"}
+	if err := store.SetProfile("anthropic:oauth", cred); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("refresh-secret")) {
+		t.Fatal("secret written to the store file")
+	}
+	if !bytes.Contains(raw, []byte("keyring:")) {
+		t.Fatal("expected keyring references in the store file")
+	}
+	if fake.count() != 2 {
+		t.Fatalf("expected 2 keyring items, got %d", fake.count())
+	}
+
+	reopened, err := aiauth.NewStore(path, aiauth.WithSecretBackend(ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Profiles()["anthropic:oauth"].Refresh; got != "refresh-secret" {
+		t.Fatalf("unexpected refresh token %q", got)
+	}
+
+	// Replacing the profile with an api_key keeps the oauth secrets while
+	// a backup still references them, so the backup can be restored.
+	if err := reopened.SetProfile("anthropic:oauth", &aiauth.Credential{Type: "api_key", Provider: "anthropic", Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.count() != 3 {
+		t.Fatalf("expected oauth secrets kept for the backup, %d items left", fake.count())
+	}
+	if err := reopened.Restore(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Profiles()["anthropic:oauth"].Refresh; got != "refresh-secret" {
+		t.Fatalf("unexpected restored refresh token %q", got)
+	}
+
+	// Without a secret backend the references cannot be resolved.
+	if _, err := aiauth.NewStore(path); err == nil {
+		t.Fatal("expected an error loading keyring references without a backend")
+	}
+}
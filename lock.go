@@ -0,0 +1,78 @@
+package aiauth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultLockTimeout is how long store writes wait for the lock file.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockPollInterval is how often a blocked lock attempt is retried.
+const lockPollInterval = 25 * time.Millisecond
+
+// LockTimeoutError is returned when the store lock file could not be
+// acquired before the configured timeout.
+type LockTimeoutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for lock %s", e.Timeout, e.Path)
+}
+
+// fileLock is an advisory, cross-process lock held on a sidecar file.
+type fileLock struct {
+	f *os.File
+}
+
+// acquireFileLock takes an exclusive advisory lock on path, creating it if
+// needed. It retries until the lock is free, timeout elapses or ctx is done.
+func acquireFileLock(ctx context.Context, path string, timeout time.Duration) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if ok {
+			return &fileLock{f: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, &LockTimeoutError{Path: path, Timeout: timeout}
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// Release drops the lock and closes the lock file.
+func (l *fileLock) Release() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	return err
+}
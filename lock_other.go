@@ -0,0 +1,11 @@
+//go:build !unix
+
+package aiauth
+
+import "os"
+
+// tryLockFile is a no-op on platforms without flock; only the in-process
+// mutex protects the store there.
+func tryLockFile(f *os.File) (bool, error) { return true, nil }
+
+func unlockFile(f *os.File) error { return nil }
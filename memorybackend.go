@@ -0,0 +1,88 @@
+package aiauth
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps the document in memory. It is useful in tests and for
+// short-lived processes that should never touch disk.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	data     []byte
+	lock     chan struct{}
+	watchers map[chan struct{}]struct{}
+}
+
+// NewMemoryBackend returns an empty in-memory backend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		lock:     make(chan struct{}, 1),
+		watchers: make(map[chan struct{}]struct{}),
+	}
+}
+
+// Load returns a copy of the saved document.
+func (b *MemoryBackend) Load() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.data == nil {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte(nil), b.data...), nil
+}
+
+// Save stores a copy of data and notifies watchers.
+func (b *MemoryBackend) Save(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append([]byte(nil), data...)
+	for ch := range b.watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Lock takes the backend's exclusive lock.
+func (b *MemoryBackend) Lock(ctx context.Context, timeout time.Duration) (func() error, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case b.lock <- struct{}{}:
+		return func() error {
+			<-b.lock
+			return nil
+		}, nil
+	case <-timer.C:
+		return nil, &LockTimeoutError{Path: "memory", Timeout: timeout}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Watch calls fn after every Save until ctx is done.
+func (b *MemoryBackend) Watch(ctx context.Context, fn func()) error {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	b.watchers[ch] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.watchers, ch)
+		b.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ch:
+			fn()
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package aiauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultAgent is the OpenClaw agent whose store DefaultStore falls back to.
+const DefaultAgent = "main"
+
+// openClawAgentsDir returns ~/.openclaw/agents.
+func openClawAgentsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".openclaw", "agents"), nil
+}
+
+// OpenClawStorePath returns the auth-profiles.json path of an OpenClaw agent.
+func OpenClawStorePath(agent string) (string, error) {
+	if agent == "" || agent == "." || agent == ".." || strings.ContainsAny(agent, `/\`) {
+		return "", fmt.Errorf("invalid agent name %q", agent)
+	}
+	dir, err := openClawAgentsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, agent, "agent", "auth-profiles.json"), nil
+}
+
+// OpenClawStore loads the store of the named OpenClaw agent.
+func OpenClawStore(agent string, opts ...StoreOption) (*Store, error) {
+	p, err := OpenClawStorePath(agent)
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(p, opts...)
+}
+
+// OpenClawAgents returns the names of the OpenClaw agents on this machine,
+// sorted. An agent is listed once its agent directory exists, whether or not
+// it has an auth-profiles.json yet.
+func OpenClawAgents() ([]string, error) {
+	dir, err := openClawAgentsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var agents []string
+	for _, e := range entries {
+		if e.IsDir() && fileExists(filepath.Join(dir, e.Name(), "agent")) {
+			agents = append(agents, e.Name())
+		}
+	}
+	sort.Strings(agents)
+	return agents, nil
+}
+
+// SyncProfiles copies src's profiles for provider into dst and returns the
+// names that changed. A profile is only overwritten when src's copy is
+// fresher: a later expiry for credentials that carry an access token
+// (oauth, token, service_account, client_credentials), or any difference
+// otherwise. Refresh tokens are not shared, since whichever store used one
+// first would invalidate it for the others: an oauth profile is copied as
+// a token profile holding only its access token to <provider>:manual, and
+// dst's own oauth profiles are left alone. Sync again after a refresh.
+func SyncProfiles(ctx context.Context, src, dst *Store, provider string) ([]string, error) {
+	src.mu.Lock()
+	var from []NamedCredential
+	for name, c := range src.data.Profiles {
+		if c.Provider == provider {
+			from = append(from, NamedCredential{name, *c})
+		}
+	}
+	src.mu.Unlock()
+	sort.Slice(from, func(i, j int) bool { return from[i].Name < from[j].Name })
+
+	var changed []string
+	err := dst.update(ctx, func(data *AuthStore) error {
+		changed = changed[:0]
+		for _, np := range from {
+			name, c := np.Name, np.Credential
+			if c.Type == "oauth" {
+				if cur, ok := data.Profiles[name]; ok && cur.Type == "oauth" && cur.Expires >= c.Expires {
+					continue // dst already has this or a newer access token
+				}
+				name = provider + ":manual"
+				c.Type, c.Token, c.Access, c.Refresh = "token", c.Access, "", ""
+			}
+			if cur, ok := data.Profiles[name]; ok && !fresher(&c, cur) {
+				continue
+			}
+			data.Profiles[name] = &c
+			if !slices.Contains(changed, name) {
+				changed = append(changed, name)
+			}
+		}
+		if len(changed) == 0 {
+			return errNoChange
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// fresher reports whether c should replace cur when syncing. An oauth
+// profile is never replaced by another type, which would drop its refresh
+// token.
+func fresher(c, cur *Credential) bool {
+	if c.Type == cur.Type && (c.Type == "oauth" || c.Type == "token" || c.Type == "service_account" || c.Type == "client_credentials") {
+		return c.Expires > cur.Expires
+	}
+	if cur.Type == "oauth" {
+		return false
+	}
+	return *c != *cur
+}
@@ -0,0 +1,83 @@
+package aiauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOpenClawAgentsAndSync(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".openclaw", "agents", "main", "agent"), 0700)
+	os.MkdirAll(filepath.Join(home, ".openclaw", "agents", "coder", "agent"), 0700)
+	os.MkdirAll(filepath.Join(home, ".openclaw", "agents", "stray"), 0700)
+
+	agents, err := OpenClawAgents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(agents, []string{"coder", "main"}) {
+		t.Fatalf("unexpected agents %v", agents)
+	}
+	if _, err := OpenClawStore("../main"); err == nil {
+		t.Fatal("expected invalid agent name to be rejected")
+	}
+
+	now := time.Now()
+	mainStore, _ := OpenClawStore("main")
+	coder, _ := OpenClawStore("coder")
+	mainStore.SetProfile("anthropic:oauth", &Credential{Type: "oauth", Provider: "anthropic", Access: "fresh", Refresh: "r2", Expires: now.Add(time.Hour).UnixMilli()})
+	mainStore.SetProfile("anthropic:manual", &Credential{Type: "token", Provider: "anthropic", Token: "fresh", Expires: now.Add(time.Hour).UnixMilli()})
+	mainStore.SetProfile("openai:key", &Credential{Type: "api_key", Provider: "openai", Key: "sk-1"})
+	coder.SetProfile("anthropic:oauth", &Credential{Type: "oauth", Provider: "anthropic", Access: "stale", Refresh: "r1", Expires: now.Add(-time.Hour).UnixMilli()})
+
+	changed, err := SyncProfiles(context.Background(), mainStore, coder, "anthropic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"anthropic:manual"}) {
+		t.Fatalf("unexpected changes %v", changed)
+	}
+	// The refresh token stays with main; coder gets the access token as
+	// anthropic:manual and keeps its own oauth login.
+	reloaded, _ := OpenClawStore("coder")
+	if got := reloaded.Profiles()["anthropic:manual"]; got == nil || got.Type != "token" || got.Token != "fresh" {
+		t.Fatalf("expected an access-token copy, got %+v", got)
+	}
+	if got := reloaded.Profiles()["anthropic:oauth"]; got.Type != "oauth" || got.Refresh != "r1" {
+		t.Fatalf("coder's oauth profile was overwritten: %+v", got)
+	}
+	if reloaded.Profiles()["openai:key"] != nil {
+		t.Fatal("other providers should not be synced")
+	}
+
+	// Syncing back does not overwrite the fresher copy.
+	if changed, _ := SyncProfiles(context.Background(), reloaded, mainStore, "anthropic"); len(changed) != 0 {
+		t.Fatalf("expected no changes, got %v", changed)
+	}
+
+	// A newer oauth access token reaches coder's anthropic:manual even when
+	// main's own manual copy is older.
+	mainStore.SetProfile("anthropic:oauth", &Credential{Type: "oauth", Provider: "anthropic", Access: "fresher", Refresh: "r3", Expires: now.Add(2 * time.Hour).UnixMilli()})
+	if changed, _ := SyncProfiles(context.Background(), mainStore, coder, "anthropic"); !slices.Equal(changed, []string{"anthropic:manual"}) {
+		t.Fatalf("unexpected changes %v", changed)
+	}
+	if c, _ := coder.Profile("anthropic:manual"); c.Token != "fresher" || c.Refresh != "" {
+		t.Fatalf("expected the newer access token only, got %+v", c.Credential)
+	}
+
+	// Nor does a client_credentials token minted earlier.
+	cred := Credential{Type: "client_credentials", Provider: "azure", TenantID: "t", ClientID: "id", ClientSecret: "s"}
+	older, newer := cred, cred
+	older.Access, older.Expires = "old", now.UnixMilli()
+	newer.Access, newer.Expires = "new", now.Add(time.Hour).UnixMilli()
+	mainStore.SetProfile("azure:client_credentials", &older)
+	coder.SetProfile("azure:client_credentials", &newer)
+	if changed, _ := SyncProfiles(context.Background(), mainStore, coder, "azure"); len(changed) != 0 {
+		t.Fatalf("expected the newer token to be kept, got %v", changed)
+	}
+}
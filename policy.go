@@ -0,0 +1,202 @@
+package aiauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ConfigEnvVar names the aiauth config file, overriding DefaultConfigPath.
+const ConfigEnvVar = "AIAUTH_CONFIG"
+
+// EnvMode controls where a provider's env var is tried during resolution.
+type EnvMode string
+
+const (
+	EnvFirst EnvMode = "first" // before any profile (the default)
+	EnvLast  EnvMode = "last"  // only if no profile is usable
+	EnvNever EnvMode = "never" // ignored
+)
+
+// defaultOrder is the credential type order used when a policy sets none.
+var defaultOrder = []string{"oauth", "service_account", "client_credentials", "aws", "token", "api_key"}
+
+// Policy controls how credentials for one provider are resolved.
+type Policy struct {
+	// Order lists the credential types to use, highest priority first.
+	// Types not listed are never used. Defaults to oauth,
+	// service_account, client_credentials, aws, token, api_key.
+	Order []string `json:"order,omitempty"`
+	// Profiles pins resolution to these profiles, tried in this order.
+	// LastGood is ignored for pinned profiles.
+	Profiles []string `json:"profiles,omitempty"`
+	// Env says where the provider's env var is tried.
+	Env EnvMode `json:"env,omitempty"`
+}
+
+// Validate reports whether p is well formed.
+func (p Policy) Validate() error {
+	for i, t := range p.Order {
+		if !slices.Contains(defaultOrder, t) {
+			return fmt.Errorf("order: unknown credential type %q", t)
+		}
+		if slices.Contains(p.Order[:i], t) {
+			return fmt.Errorf("order: duplicate credential type %q", t)
+		}
+	}
+	for i, name := range p.Profiles {
+		if name == "" {
+			return errors.New("profiles: empty profile name")
+		}
+		if slices.Contains(p.Profiles[:i], name) {
+			return fmt.Errorf("profiles: duplicate profile %q", name)
+		}
+	}
+	switch p.Env {
+	case "", EnvFirst, EnvLast, EnvNever:
+	default:
+		return fmt.Errorf("env: unknown mode %q (want first, last or never)", p.Env)
+	}
+	return nil
+}
+
+// rank returns the priority of a credential type under p (lower is higher
+// priority), or -1 if the type is not allowed.
+func (p Policy) rank(typ string) int {
+	order := p.Order
+	if len(order) == 0 {
+		order = defaultOrder
+	}
+	return slices.Index(order, typ)
+}
+
+func (p Policy) envMode() EnvMode {
+	if p.Env == "" {
+		return EnvFirst
+	}
+	return p.Env
+}
+
+// Config is the aiauth config file.
+type Config struct {
+	// Providers maps provider names to their resolution policy.
+	Providers map[string]Policy `json:"providers,omitempty"`
+}
+
+// Validate reports whether every policy in c is well formed.
+func (c *Config) Validate() error {
+	for name, p := range c.Providers {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("provider %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// DefaultConfigPath returns the config file path: $AIAUTH_CONFIG, or
+// config.json in the aiauth user config directory.
+func DefaultConfigPath() (string, error) {
+	if p := os.Getenv(ConfigEnvVar); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "aiauth", "config.json"), nil
+}
+
+// LoadConfig reads and validates a config file.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// configFromEnv loads the default config file. A missing file is only an
+// error when it was named explicitly with $AIAUTH_CONFIG.
+func configFromEnv() (*Config, error) {
+	path, err := DefaultConfigPath()
+	if err != nil {
+		return &Config{}, nil
+	}
+	c, err := LoadConfig(path)
+	if errors.Is(err, os.ErrNotExist) && os.Getenv(ConfigEnvVar) == "" {
+		return &Config{}, nil
+	}
+	return c, err
+}
+
+// WithConfig uses c instead of the config file. Policies set with
+// WithPolicy still take precedence.
+func WithConfig(c *Config) StoreOption {
+	return func(s *Store) { s.config = c }
+}
+
+// WithPolicy sets the resolution policy for one provider, overriding the
+// config file.
+func WithPolicy(provider string, p Policy) StoreOption {
+	return func(s *Store) {
+		if s.policies == nil {
+			s.policies = make(map[string]Policy)
+		}
+		s.policies[provider] = p
+	}
+}
+
+// WithProfile pins provider to a single profile, keeping the rest of its
+// policy.
+func WithProfile(provider, profile string) StoreOption {
+	return func(s *Store) {
+		if s.pins == nil {
+			s.pins = make(map[string]string)
+		}
+		s.pins[provider] = profile
+	}
+}
+
+// initPolicies loads the config file if none was given and validates the
+// result; called once all options are applied.
+func (s *Store) initPolicies() error {
+	if s.config == nil {
+		c, err := configFromEnv()
+		if err != nil {
+			s.config = &Config{}
+			return err
+		}
+		s.config = c
+	}
+	if err := s.config.Validate(); err != nil {
+		return err
+	}
+	for name, p := range s.policies {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("policy for %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Policy returns the resolution policy in effect for provider.
+func (s *Store) Policy(provider string) Policy {
+	p, ok := s.policies[provider]
+	if !ok && s.config != nil {
+		p = s.config.Providers[provider]
+	}
+	if pin, ok := s.pins[provider]; ok {
+		p.Profiles = []string{pin}
+	}
+	return p
+}
@@ -1,5 +1,7 @@
 package aiauth
 
+import "context"
+
 // Provider defines the interface for an LLM auth provider.
 type Provider interface {
 	ID() string
@@ -7,8 +9,64 @@ type Provider interface {
 	RefreshToken(cred *Credential) (*Credential, error)
 }
 
+// ContextProvider is a Provider whose network calls honour a context, so
+// callers can bound login and refresh with deadlines or cancel them.
+type ContextProvider interface {
+	ID() string
+	LoginContext(ctx context.Context, callbacks LoginCallbacks) (*Credential, error)
+	RefreshTokenContext(ctx context.Context, cred *Credential) (*Credential, error)
+}
+
 // LoginCallbacks provides hooks for interactive login flows.
 type LoginCallbacks struct {
 	OnAuthURL func(url string) error              // open browser
 	OnPrompt  func(message string) (string, error) // get user input
 }
+
+// AdaptProvider returns p as a ContextProvider. Providers that already
+// implement ContextProvider are returned unchanged; older implementations are
+// wrapped so the context is checked before each call. A refresh that has
+// started cannot be interrupted, but once ctx is done the wrapper stops
+// waiting for it and returns ctx's error; its result, if any, is discarded.
+func AdaptProvider(p Provider) ContextProvider {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp
+	}
+	return providerAdapter{p}
+}
+
+type providerAdapter struct{ p Provider }
+
+func (a providerAdapter) ID() string { return a.p.ID() }
+
+func (a providerAdapter) LoginContext(ctx context.Context, cb LoginCallbacks) (*Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.p.Login(cb)
+}
+
+func (a providerAdapter) RefreshTokenContext(ctx context.Context, cred *Credential) (*Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return a.p.RefreshToken(cred)
+	}
+	type result struct {
+		cred *Credential
+		err  error
+	}
+	done := make(chan result, 1)
+	cp := *cred // the call may outlive ours
+	go func() {
+		c, err := a.p.RefreshToken(&cp)
+		done <- result{c, err}
+	}()
+	select {
+	case r := <-done:
+		return r.cred, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -2,6 +2,7 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,14 +22,43 @@ const (
 	AnthropicScopes       = "org:create_api_key user:profile user:inference"
 )
 
-// Anthropic implements the aiauth.Provider interface.
-type Anthropic struct{}
+// DefaultHTTPTimeout bounds token requests when no HTTPClient is set.
+const DefaultHTTPTimeout = 30 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
+// Anthropic implements the aiauth.Provider and aiauth.ContextProvider interfaces.
+type Anthropic struct {
+	// HTTPClient is used for token requests. Defaults to a client with
+	// DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// TokenURL overrides AnthropicTokenURL.
+	TokenURL string
+}
 
 func NewAnthropic() *Anthropic { return &Anthropic{} }
 
 func (a *Anthropic) ID() string { return "anthropic" }
 
+func (a *Anthropic) client() *http.Client {
+	if a.HTTPClient != nil {
+		return a.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (a *Anthropic) tokenURL() string {
+	if a.TokenURL != "" {
+		return a.TokenURL
+	}
+	return AnthropicTokenURL
+}
+
 func (a *Anthropic) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	return a.LoginContext(context.Background(), cb)
+}
+
+func (a *Anthropic) LoginContext(ctx context.Context, cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
 	verifier, challenge, err := aiauth.GeneratePKCE()
 	if err != nil {
 		return nil, fmt.Errorf("PKCE generation failed: %w", err)
@@ -70,10 +100,10 @@ func (a *Anthropic) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error)
 		state = parts[1]
 	}
 
-	return a.exchangeCode(authCode, state, verifier)
+	return a.exchangeCode(ctx, authCode, state, verifier)
 }
 
-func (a *Anthropic) exchangeCode(code, state, verifier string) (*aiauth.Credential, error) {
+func (a *Anthropic) exchangeCode(ctx context.Context, code, state, verifier string) (*aiauth.Credential, error) {
 	// Use JSON body (not form-encoded) to match pi-ai's flow
 	payload := map[string]string{
 		"grant_type":    "authorization_code",
@@ -85,7 +115,7 @@ func (a *Anthropic) exchangeCode(code, state, verifier string) (*aiauth.Credenti
 	}
 	jsonBody, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", AnthropicTokenURL, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL(), bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -93,7 +123,7 @@ func (a *Anthropic) exchangeCode(code, state, verifier string) (*aiauth.Credenti
 	req.Header.Set("User-Agent", "aiauth/1.0")
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("token exchange failed: %w", err)
 	}
@@ -126,6 +156,10 @@ func (a *Anthropic) exchangeCode(code, state, verifier string) (*aiauth.Credenti
 }
 
 func (a *Anthropic) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, error) {
+	return a.RefreshTokenContext(context.Background(), cred)
+}
+
+func (a *Anthropic) RefreshTokenContext(ctx context.Context, cred *aiauth.Credential) (*aiauth.Credential, error) {
 	if cred.Refresh == "" {
 		return nil, fmt.Errorf("no refresh token available")
 	}
@@ -138,7 +172,7 @@ func (a *Anthropic) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, e
 	}
 	jsonBody, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", AnthropicTokenURL, bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL(), bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -146,7 +180,7 @@ func (a *Anthropic) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, e
 	req.Header.Set("User-Agent", "aiauth/1.0")
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := a.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("token refresh failed: %w", err)
 	}
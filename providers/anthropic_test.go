@@ -0,0 +1,118 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func TestRefreshTokenHonoursDeadline(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	a := &Anthropic{TokenURL: srv.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := a.RefreshTokenContext(ctx, &aiauth.Credential{Type: "oauth", Provider: "anthropic", Refresh: "r"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("refresh did not return promptly after the deadline")
+	}
+}
+
+// TestConcurrentRefreshIsDeduplicated hammers ResolveKey right after expiry
+// from several stores sharing one file (standing in for separate processes)
+// against a token server that, like the real one, rejects a refresh token
+// once it has been used.
+func TestConcurrentRefreshIsDeduplicated(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["refresh_token"] != "refresh-1" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-2",
+			"refresh_token": "refresh-2",
+			"expires_in":    3600,
+		})
+	}))
+	defer srv.Close()
+	aiauth.RegisterProvider(&Anthropic{TokenURL: srv.URL})
+	defer aiauth.RegisterProvider(NewAnthropic())
+
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	seed, _ := aiauth.NewStore(path)
+	err := seed.SetProfile("anthropic:oauth", &aiauth.Credential{
+		Type:     "oauth",
+		Provider: "anthropic",
+		Access:   "access-1",
+		Refresh:  "refresh-1",
+		Expires:  time.Now().Add(-time.Minute).UnixMilli(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stores []*aiauth.Store
+	for i := 0; i < 3; i++ {
+		s, err := aiauth.NewStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, s)
+	}
+
+	const perStore = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, len(stores)*perStore)
+	for _, s := range stores {
+		for i := 0; i < perStore; i++ {
+			wg.Add(1)
+			go func(s *aiauth.Store) {
+				defer wg.Done()
+				key, err := s.ResolveKey("anthropic")
+				if err == nil && key != "access-2" {
+					err = errors.New("got key " + key)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}(s)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected exactly 1 token request, got %d", n)
+	}
+}
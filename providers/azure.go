@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+// Microsoft Entra ID client credentials for Azure OpenAI.
+const (
+	AzureAuthorityURL = "https://login.microsoftonline.com"
+	AzureScope        = "https://cognitiveservices.azure.com/.default"
+)
+
+// Azure implements the aiauth.Provider and aiauth.ContextProvider
+// interfaces for client_credentials credentials: RefreshToken exchanges the
+// app's client ID and secret for an access token at the tenant's token
+// endpoint, which the store caches on the profile until it is about to
+// expire. Login asks for the app and deployment details at the prompt.
+//
+// Azure OpenAI also accepts static keys, stored as api_key profiles and
+// sent in the api-key header. Either kind of profile records the resource
+// Endpoint, Deployment and APIVersion, which Resolve passes through.
+//
+// Managed identity tokens, which come from the host's instance metadata
+// service rather than an app registration, are not supported.
+type Azure struct {
+	// HTTPClient is used for token requests. Defaults to a client with
+	// DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// AuthorityURL overrides AzureAuthorityURL, e.g. for a sovereign
+	// cloud. The token endpoint is <AuthorityURL>/<tenant>/oauth2/v2.0/token.
+	// A credential's own AuthorityURL takes precedence.
+	AuthorityURL string
+	// Scope overrides AzureScope.
+	Scope string
+}
+
+func NewAzure() *Azure { return &Azure{} }
+
+func (a *Azure) ID() string { return "azure" }
+
+func (a *Azure) client() *http.Client {
+	if a.HTTPClient != nil {
+		return a.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (a *Azure) scope() string {
+	if a.Scope != "" {
+		return a.Scope
+	}
+	return AzureScope
+}
+
+// tokenURL returns the token endpoint of cred's tenant.
+func (a *Azure) tokenURL(cred *aiauth.Credential) string {
+	authority := AzureAuthorityURL
+	switch {
+	case cred.AuthorityURL != "":
+		authority = cred.AuthorityURL
+	case a.AuthorityURL != "":
+		authority = a.AuthorityURL
+	}
+	return strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(cred.TenantID) + "/oauth2/v2.0/token"
+}
+
+func (a *Azure) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	return a.LoginContext(context.Background(), cb)
+}
+
+// LoginContext asks for an Entra ID app's tenant, client ID and secret,
+// its authority if not the public cloud, and the Azure OpenAI deployment,
+// and checks that the app can get a token.
+func (a *Azure) LoginContext(ctx context.Context, cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	if cb.OnPrompt == nil {
+		return nil, errors.New("azure login needs an OnPrompt callback")
+	}
+	cred := &aiauth.Credential{Type: "client_credentials", Provider: "azure"}
+	for _, q := range []struct {
+		prompt   string
+		field    *string
+		required bool
+	}{
+		{"Tenant ID:", &cred.TenantID, true},
+		{"Client ID:", &cred.ClientID, true},
+		{"Client secret:", &cred.ClientSecret, true},
+		{"Authority URL (blank for " + AzureAuthorityURL + "):", &cred.AuthorityURL, false},
+		{"Endpoint (https://<resource>.openai.azure.com):", &cred.Endpoint, false},
+		{"Deployment (optional):", &cred.Deployment, false},
+		{"API version (optional):", &cred.APIVersion, false},
+	} {
+		v, err := cb.OnPrompt(q.prompt)
+		if err != nil {
+			return nil, err
+		}
+		*q.field = strings.TrimSpace(v)
+		if q.required && *q.field == "" {
+			return nil, fmt.Errorf("%s is required", strings.TrimSuffix(q.prompt, ":"))
+		}
+	}
+	return a.RefreshTokenContext(ctx, cred)
+}
+
+func (a *Azure) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, error) {
+	return a.RefreshTokenContext(context.Background(), cred)
+}
+
+// RefreshTokenContext gets a new access token for a client_credentials
+// credential.
+func (a *Azure) RefreshTokenContext(ctx context.Context, cred *aiauth.Credential) (*aiauth.Credential, error) {
+	switch {
+	case cred.Type != "client_credentials":
+		return nil, fmt.Errorf("cannot refresh a %s credential; only client_credentials", cred.Type)
+	case cred.TenantID == "" || cred.ClientID == "" || cred.ClientSecret == "":
+		return nil, errors.New("client_credentials credential needs a tenant, client id and secret")
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {cred.ClientID},
+		"client_secret": {cred.ClientSecret},
+		"scope":         {a.scope()},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.tokenURL(cred), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "aiauth/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token request returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response had no access token")
+	}
+
+	refreshed := *cred
+	refreshed.Access = tokenResp.AccessToken
+	refreshed.Expires = time.Now().UnixMilli() + tokenResp.ExpiresIn*1000 - 5*60*1000
+	return &refreshed, nil
+}
@@ -0,0 +1,95 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func TestAzureClientCredentials(t *testing.T) {
+	var grants atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" || r.PostForm.Get("grant_type") != "client_credentials" ||
+			r.PostForm.Get("client_id") != "app-1" || r.PostForm.Get("client_secret") != "s3cret" || r.PostForm.Get("scope") != AzureScope {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		grants.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "entra-token", "expires_in": 3600})
+	}))
+	defer srv.Close()
+
+	aiauth.RegisterContextProvider(&Azure{AuthorityURL: srv.URL})
+	store, _ := aiauth.OpenStore(aiauth.NewMemoryBackend())
+	store.SetProfile("azure:app", &aiauth.Credential{
+		Type: "client_credentials", Provider: "azure",
+		TenantID: "tenant-1", ClientID: "app-1", ClientSecret: "s3cret",
+		Endpoint: "https://res.openai.azure.com", Deployment: "gpt-4o", APIVersion: "2024-10-21",
+	})
+	t.Setenv("AZURE_OPENAI_API_KEY", "")
+
+	for range 2 {
+		res, err := store.Resolve("azure")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Secret != "entra-token" || res.Scheme != aiauth.SchemeBearer || res.Endpoint != "https://res.openai.azure.com" ||
+			res.Deployment != "gpt-4o" || res.APIVersion != "2024-10-21" {
+			t.Fatalf("unexpected resolution %+v", res)
+		}
+	}
+	if n := grants.Load(); n != 1 {
+		t.Fatalf("expected the token to be cached, got %d grants", n)
+	}
+
+	// A forced refresh goes through the same provider path.
+	if _, err := store.RefreshProfile("azure:app", &Azure{AuthorityURL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if n := grants.Load(); n != 2 {
+		t.Fatalf("expected RefreshProfile to get a new token, got %d grants", n)
+	}
+
+	// A profile that records its own authority refreshes with the default
+	// provider, as the CLI registers it.
+	store.SetProfile("azure:sovereign", &aiauth.Credential{
+		Type: "client_credentials", Provider: "azure", AuthorityURL: srv.URL,
+		TenantID: "tenant-1", ClientID: "app-1", ClientSecret: "s3cret",
+	})
+	if _, err := store.RefreshProfile("azure:sovereign", NewAzure()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Login asks for the authority and the deployment metadata.
+	answers := []string{"tenant-1", "app-1", "s3cret", srv.URL, "https://res.openai.azure.com", "gpt-4o", "2024-10-21"}
+	cred, err := NewAzure().LoginContext(context.Background(), aiauth.LoginCallbacks{
+		OnPrompt: func(string) (string, error) {
+			a := answers[0]
+			answers = answers[1:]
+			return a, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Access != "entra-token" || cred.AuthorityURL != srv.URL || cred.APIVersion != "2024-10-21" {
+		t.Fatalf("unexpected login credential %+v", cred)
+	}
+
+	// Static keys come from the env var with the endpoint alongside.
+	t.Setenv("AZURE_OPENAI_API_KEY", "static-key")
+	t.Setenv(aiauth.AzureEndpointEnvVar, "https://env.openai.azure.com")
+	res, err := store.Resolve("azure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Secret != "static-key" || res.Scheme != aiauth.SchemeAPIKey || res.Endpoint != "https://env.openai.azure.com" {
+		t.Fatalf("unexpected env resolution %+v", res)
+	}
+}
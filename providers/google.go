@@ -0,0 +1,335 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+// Installed-app OAuth, as used by the Gemini CLI. Google treats the client
+// secret of an installed app as public; it is published in the Gemini CLI
+// source.
+const (
+	GoogleClientID      = "681255809395-oo8ft2oprdrnp9e3aqf6av3hmdib135j.apps.googleusercontent.com"
+	GoogleClientSecret  = "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"
+	GoogleAuthorizeURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	GoogleTokenURL      = "https://oauth2.googleapis.com/token"
+	GoogleUserInfoURL   = "https://www.googleapis.com/oauth2/v2/userinfo"
+	GoogleCodeAssistURL = "https://cloudcode-pa.googleapis.com/v1internal:loadCodeAssist"
+	GoogleScopes        = "https://www.googleapis.com/auth/cloud-platform https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile"
+	// GoogleCallbackAddr is the loopback address to listen on; installed
+	// apps may use any port, so one is picked at random.
+	GoogleCallbackAddr = "localhost:0"
+	googleCallbackPath = "/oauth2callback"
+	// GoogleProjectEnvVar names the Google Cloud project to prefer when the
+	// account has access to several.
+	GoogleProjectEnvVar = "GOOGLE_CLOUD_PROJECT"
+)
+
+// Google implements the aiauth.Provider and aiauth.ContextProvider
+// interfaces with the Google sign-in used by the Gemini CLI. Login runs a
+// PKCE flow that receives the code on a loopback HTTP server, falling back
+// to asking for the redirect URL like OpenAI. After sign-in it looks up the
+// account's email and the Google Cloud project Gemini Code Assist assigns
+// it, recorded as the credential's ProjectID; both lookups are best effort.
+type Google struct {
+	// HTTPClient is used for token and lookup requests. Defaults to a client
+	// with DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// AuthorizeURL overrides GoogleAuthorizeURL.
+	AuthorizeURL string
+	// TokenURL overrides GoogleTokenURL.
+	TokenURL string
+	// UserInfoURL overrides GoogleUserInfoURL.
+	UserInfoURL string
+	// CodeAssistURL overrides GoogleCodeAssistURL.
+	CodeAssistURL string
+	// CallbackAddr overrides GoogleCallbackAddr.
+	CallbackAddr string
+	// Project is the project to ask Code Assist for. Defaults to
+	// $GOOGLE_CLOUD_PROJECT; if neither is set Code Assist picks one.
+	Project string
+}
+
+func NewGoogle() *Google { return &Google{} }
+
+func (g *Google) ID() string { return "google" }
+
+func (g *Google) client() *http.Client {
+	if g.HTTPClient != nil {
+		return g.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (g *Google) authorizeURL() string {
+	if g.AuthorizeURL != "" {
+		return g.AuthorizeURL
+	}
+	return GoogleAuthorizeURL
+}
+
+func (g *Google) tokenURL() string {
+	if g.TokenURL != "" {
+		return g.TokenURL
+	}
+	return GoogleTokenURL
+}
+
+func (g *Google) userInfoURL() string {
+	if g.UserInfoURL != "" {
+		return g.UserInfoURL
+	}
+	return GoogleUserInfoURL
+}
+
+func (g *Google) codeAssistURL() string {
+	if g.CodeAssistURL != "" {
+		return g.CodeAssistURL
+	}
+	return GoogleCodeAssistURL
+}
+
+func (g *Google) callbackAddr() string {
+	if g.CallbackAddr != "" {
+		return g.CallbackAddr
+	}
+	return GoogleCallbackAddr
+}
+
+func (g *Google) project() string {
+	if g.Project != "" {
+		return g.Project
+	}
+	return os.Getenv(GoogleProjectEnvVar)
+}
+
+func (g *Google) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	return g.LoginContext(context.Background(), cb)
+}
+
+func (g *Google) LoginContext(ctx context.Context, cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	verifier, challenge, err := aiauth.GeneratePKCE()
+	if err != nil {
+		return nil, fmt.Errorf("PKCE generation failed: %w", err)
+	}
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, redirectURI, listenErr := listenLoopback(g.callbackAddr(), googleCallbackPath)
+	if listenErr == nil {
+		defer ln.Close()
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {GoogleClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {GoogleScopes},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+		"state":                 {state},
+		// Ask for a refresh token, and for a new one even if the user has
+		// consented before.
+		"access_type": {"offline"},
+		"prompt":      {"consent"},
+	}
+	authURL := g.authorizeURL() + "?" + params.Encode()
+
+	if cb.OnAuthURL != nil {
+		if err := cb.OnAuthURL(authURL); err != nil {
+			return nil, err
+		}
+	}
+
+	var code string
+	if listenErr == nil {
+		code, err = waitForCallback(ctx, ln, googleCallbackPath, state)
+	} else {
+		code, err = promptForCode(cb, state, listenErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := g.token(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {GoogleClientID},
+		"client_secret": {GoogleClientSecret},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if cred.Email == "" {
+		cred.Email, _ = g.email(ctx, cred.Access)
+	}
+	cred.ProjectID = g.project()
+	if project, err := g.loadCodeAssist(ctx, cred.Access); err == nil && project != "" {
+		cred.ProjectID = project
+	}
+	return cred, nil
+}
+
+func (g *Google) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, error) {
+	return g.RefreshTokenContext(context.Background(), cred)
+}
+
+func (g *Google) RefreshTokenContext(ctx context.Context, cred *aiauth.Credential) (*aiauth.Credential, error) {
+	if cred.Refresh == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+	return g.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {GoogleClientID},
+		"client_secret": {GoogleClientSecret},
+		"refresh_token": {cred.Refresh},
+	}, cred)
+}
+
+// token posts a form to the token endpoint and builds the credential from
+// the response. prev, when refreshing, supplies values the response omits;
+// Google does not rotate refresh tokens.
+func (g *Google) token(ctx context.Context, form url.Values, prev *aiauth.Credential) (*aiauth.Credential, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", g.tokenURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "aiauth/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token request returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response had no access token")
+	}
+
+	cred := &aiauth.Credential{
+		Type:     "oauth",
+		Provider: "google",
+		Access:   tokenResp.AccessToken,
+		Refresh:  tokenResp.RefreshToken,
+		Expires:  time.Now().UnixMilli() + tokenResp.ExpiresIn*1000 - 5*60*1000,
+	}
+	if prev != nil {
+		if cred.Refresh == "" {
+			cred.Refresh = prev.Refresh
+		}
+		cred.Email, cred.ProjectID = prev.Email, prev.ProjectID
+	}
+
+	var claims struct {
+		Email string `json:"email"`
+	}
+	if decodeJWTClaims(tokenResp.IDToken, &claims) == nil && claims.Email != "" {
+		cred.Email = claims.Email
+	}
+	return cred, nil
+}
+
+// email looks up the signed-in account's email address.
+func (g *Google) email(ctx context.Context, access string) (string, error) {
+	var info struct {
+		Email string `json:"email"`
+	}
+	err := g.doJSON(ctx, "GET", g.userInfoURL(), access, nil, &info)
+	return info.Email, err
+}
+
+// loadCodeAssist asks Gemini Code Assist which Google Cloud project the
+// account uses, preferring the configured one.
+func (g *Google) loadCodeAssist(ctx context.Context, access string) (string, error) {
+	type metadata struct {
+		IDEType     string `json:"ideType"`
+		Platform    string `json:"platform"`
+		PluginType  string `json:"pluginType"`
+		DuetProject string `json:"duetProject,omitempty"`
+	}
+	project := g.project()
+	reqBody := struct {
+		Project  string   `json:"cloudaicompanionProject,omitempty"`
+		Metadata metadata `json:"metadata"`
+	}{
+		Project: project,
+		Metadata: metadata{
+			IDEType:     "IDE_UNSPECIFIED",
+			Platform:    "PLATFORM_UNSPECIFIED",
+			PluginType:  "GEMINI",
+			DuetProject: project,
+		},
+	}
+	var out struct {
+		Project string `json:"cloudaicompanionProject"`
+	}
+	err := g.doJSON(ctx, "POST", g.codeAssistURL(), access, reqBody, &out)
+	return out.Project, err
+}
+
+// doJSON makes an authenticated JSON request, sending in as the body when
+// it is non-nil, and decodes the response into out.
+func (g *Google) doJSON(ctx context.Context, method, u, access string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("User-Agent", "aiauth/1.0")
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s returned %d: %s", u, resp.StatusCode, b)
+	}
+	return json.Unmarshal(b, out)
+}
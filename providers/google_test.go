@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func TestGoogleLoginAndRefresh(t *testing.T) {
+	var redirectURI string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("client_secret") != GoogleClientSecret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if r.PostForm.Get("code") != "the-code" || r.PostForm.Get("redirect_uri") != redirectURI {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access-1", "refresh_token": "refresh-1", "expires_in": 3600})
+		case "refresh_token":
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "expires_in": 3600})
+		}
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"email": "dev@example.com"})
+	})
+	mux.HandleFunc("/codeassist", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Project string `json:"cloudaicompanionProject"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("Authorization") != "Bearer access-1" || req.Project != "preferred" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"cloudaicompanionProject": "assigned-project"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	g := &Google{
+		TokenURL:      srv.URL + "/token",
+		UserInfoURL:   srv.URL + "/userinfo",
+		CodeAssistURL: srv.URL + "/codeassist",
+		CallbackAddr:  "127.0.0.1:0",
+		Project:       "preferred",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cred, err := g.LoginContext(ctx, aiauth.LoginCallbacks{
+		OnAuthURL: func(authURL string) error {
+			u, _ := url.Parse(authURL)
+			q := u.Query()
+			redirectURI = q.Get("redirect_uri")
+			if q.Get("access_type") != "offline" || !strings.HasSuffix(redirectURI, googleCallbackPath) {
+				t.Errorf("unexpected auth URL %s", authURL)
+			}
+			go func() {
+				cb := redirectURI + "?" + url.Values{"code": {"the-code"}, "state": {q.Get("state")}}.Encode()
+				if resp, err := http.Get(cb); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Provider != "google" || cred.Refresh != "refresh-1" || cred.Email != "dev@example.com" || cred.ProjectID != "assigned-project" {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+
+	refreshed, err := g.RefreshTokenContext(ctx, cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Access != "access-2" || refreshed.Refresh != "refresh-1" || refreshed.ProjectID != "assigned-project" {
+		t.Fatalf("refresh lost fields: %+v", refreshed)
+	}
+}
@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+// listenLoopback listens on addr for an OAuth redirect to path and returns
+// the redirect URI to register. The URI keeps addr's host, which must match
+// what the client registered (usually "localhost"), with the port actually
+// bound, so addr may use port 0. On error the URI is still built from addr
+// for the paste-the-URL fallback.
+func listenLoopback(addr, path string) (net.Listener, string, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "http://" + addr + path, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return ln, "http://" + net.JoinHostPort(host, port) + path, nil
+}
+
+// waitForCallback serves the loopback redirect on path until it delivers a
+// code for state or ctx is done.
+func waitForCallback(ctx context.Context, ln net.Listener, path, state string) (string, error) {
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	srv := &http.Server{
+		ReadHeaderTimeout: 10 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != path {
+				http.NotFound(w, r)
+				return
+			}
+			q := r.URL.Query()
+			var res result
+			switch {
+			case q.Get("state") != state:
+				http.Error(w, "State mismatch.", http.StatusBadRequest)
+				return // ignore stray requests; keep waiting
+			case q.Get("error") != "":
+				res.err = fmt.Errorf("authorization failed: %s %s", q.Get("error"), q.Get("error_description"))
+				http.Error(w, "Authorization failed. You can close this window.", http.StatusBadRequest)
+			case q.Get("code") == "":
+				res.err = errors.New("authorization callback had no code")
+				http.Error(w, "Missing authorization code.", http.StatusBadRequest)
+			default:
+				res.code = q.Get("code")
+				fmt.Fprintln(w, "Signed in. You can close this window and return to the terminal.")
+			}
+			select {
+			case done <- res:
+			default:
+			}
+		}),
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	select {
+	case res := <-done:
+		return res.code, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// promptForCode asks the user to paste the redirect URL (or just the code)
+// when the loopback server could not be started.
+func promptForCode(cb aiauth.LoginCallbacks, state string, listenErr error) (string, error) {
+	if cb.OnPrompt == nil {
+		return "", fmt.Errorf("cannot listen for the OAuth callback (%v) and no OnPrompt callback set", listenErr)
+	}
+	input, err := cb.OnPrompt("Paste the URL your browser was redirected to:")
+	if err != nil {
+		return "", err
+	}
+	input = strings.TrimSpace(input)
+	if !strings.Contains(input, "code=") {
+		return input, nil
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	q := u.Query()
+	if got := q.Get("state"); got != "" && got != state {
+		return "", errors.New("state mismatch in redirect URL")
+	}
+	return q.Get("code"), nil
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
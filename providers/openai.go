@@ -0,0 +1,236 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+// ChatGPT/Codex OAuth, as used by the Codex CLI.
+const (
+	OpenAIClientID     = "app_EMoamEEZ73f0CkXaXp7hrann"
+	OpenAIAuthorizeURL = "https://auth.openai.com/oauth/authorize"
+	OpenAITokenURL     = "https://auth.openai.com/oauth/token"
+	OpenAIScopes       = "openid profile email offline_access"
+	// OpenAICallbackAddr is the loopback address registered for the client;
+	// the redirect URI is http://localhost:1455/auth/callback.
+	OpenAICallbackAddr = "localhost:1455"
+	openAICallbackPath = "/auth/callback"
+)
+
+// OpenAI implements the aiauth.Provider and aiauth.ContextProvider
+// interfaces with the ChatGPT sign-in used by Codex. Login runs a PKCE flow
+// that receives the code on a loopback HTTP server; if that cannot listen
+// (for example on a remote machine) the user is asked to paste the redirect
+// URL instead.
+type OpenAI struct {
+	// HTTPClient is used for token requests. Defaults to a client with
+	// DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// AuthorizeURL overrides OpenAIAuthorizeURL.
+	AuthorizeURL string
+	// TokenURL overrides OpenAITokenURL.
+	TokenURL string
+	// CallbackAddr overrides OpenAICallbackAddr, e.g. "127.0.0.1:0" in tests.
+	CallbackAddr string
+}
+
+func NewOpenAI() *OpenAI { return &OpenAI{} }
+
+func (o *OpenAI) ID() string { return "openai" }
+
+func (o *OpenAI) client() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (o *OpenAI) authorizeURL() string {
+	if o.AuthorizeURL != "" {
+		return o.AuthorizeURL
+	}
+	return OpenAIAuthorizeURL
+}
+
+func (o *OpenAI) tokenURL() string {
+	if o.TokenURL != "" {
+		return o.TokenURL
+	}
+	return OpenAITokenURL
+}
+
+func (o *OpenAI) callbackAddr() string {
+	if o.CallbackAddr != "" {
+		return o.CallbackAddr
+	}
+	return OpenAICallbackAddr
+}
+
+func (o *OpenAI) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	return o.LoginContext(context.Background(), cb)
+}
+
+func (o *OpenAI) LoginContext(ctx context.Context, cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	verifier, challenge, err := aiauth.GeneratePKCE()
+	if err != nil {
+		return nil, fmt.Errorf("PKCE generation failed: %w", err)
+	}
+	state, err := randomState()
+	if err != nil {
+		return nil, err
+	}
+
+	// Listen before showing the URL so the browser cannot beat us to it.
+	ln, redirectURI, listenErr := listenLoopback(o.callbackAddr(), openAICallbackPath)
+	if listenErr == nil {
+		defer ln.Close()
+	}
+
+	params := url.Values{
+		"response_type":              {"code"},
+		"client_id":                  {OpenAIClientID},
+		"redirect_uri":               {redirectURI},
+		"scope":                      {OpenAIScopes},
+		"code_challenge":             {challenge},
+		"code_challenge_method":      {"S256"},
+		"state":                      {state},
+		"id_token_add_organizations": {"true"},
+		"codex_cli_simplified_flow":  {"true"},
+	}
+	authURL := o.authorizeURL() + "?" + params.Encode()
+
+	if cb.OnAuthURL != nil {
+		if err := cb.OnAuthURL(authURL); err != nil {
+			return nil, err
+		}
+	}
+
+	var code string
+	if listenErr == nil {
+		code, err = waitForCallback(ctx, ln, openAICallbackPath, state)
+	} else {
+		code, err = promptForCode(cb, state, listenErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return o.token(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {OpenAIClientID},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	}, nil)
+}
+
+func (o *OpenAI) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, error) {
+	return o.RefreshTokenContext(context.Background(), cred)
+}
+
+func (o *OpenAI) RefreshTokenContext(ctx context.Context, cred *aiauth.Credential) (*aiauth.Credential, error) {
+	if cred.Refresh == "" {
+		return nil, fmt.Errorf("no refresh token available")
+	}
+	return o.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {OpenAIClientID},
+		"refresh_token": {cred.Refresh},
+		"scope":         {"openid profile email"},
+	}, cred)
+}
+
+// token posts a form to the token endpoint and builds the credential from
+// the response. prev, when refreshing, supplies values the response omits.
+func (o *OpenAI) token(ctx context.Context, form url.Values, prev *aiauth.Credential) (*aiauth.Credential, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", o.tokenURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "aiauth/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token request returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response had no access token")
+	}
+
+	cred := &aiauth.Credential{
+		Type:     "oauth",
+		Provider: "openai",
+		Access:   tokenResp.AccessToken,
+		Refresh:  tokenResp.RefreshToken,
+		Expires:  time.Now().UnixMilli() + tokenResp.ExpiresIn*1000 - 5*60*1000,
+	}
+	if prev != nil {
+		if cred.Refresh == "" {
+			cred.Refresh = prev.Refresh
+		}
+		cred.Email, cred.AccountID = prev.Email, prev.AccountID
+	}
+
+	// The ChatGPT account ID is needed for the Codex backend; both it and
+	// the email are claims on the tokens.
+	var claims struct {
+		Email string `json:"email"`
+		Auth  struct {
+			AccountID string `json:"chatgpt_account_id"`
+		} `json:"https://api.openai.com/auth"`
+	}
+	for _, tok := range []string{tokenResp.AccessToken, tokenResp.IDToken} {
+		if decodeJWTClaims(tok, &claims) != nil {
+			continue
+		}
+		if claims.Auth.AccountID != "" {
+			cred.AccountID = claims.Auth.AccountID
+		}
+		if claims.Email != "" {
+			cred.Email = claims.Email
+		}
+	}
+	return cred, nil
+}
+
+// decodeJWTClaims decodes the payload of a JWT without verifying it; the
+// token came straight from the token endpoint over TLS.
+func decodeJWTClaims(token string, v any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errors.New("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
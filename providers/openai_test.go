@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func fakeJWT(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func TestOpenAILoginAndRefresh(t *testing.T) {
+	var challenge, redirectURI string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "the-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge ||
+				r.PostForm.Get("redirect_uri") != redirectURI {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  fakeJWT(map[string]any{"https://api.openai.com/auth": map[string]any{"chatgpt_account_id": "acct-1"}}),
+				"refresh_token": "refresh-1",
+				"id_token":      fakeJWT(map[string]any{"email": "dev@example.com"}),
+				"expires_in":    3600,
+			})
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh-1" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"access_token": "access-2", "expires_in": 3600})
+		}
+	}))
+	defer srv.Close()
+
+	o := &OpenAI{TokenURL: srv.URL, CallbackAddr: "127.0.0.1:0"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cred, err := o.LoginContext(ctx, aiauth.LoginCallbacks{
+		OnAuthURL: func(authURL string) error {
+			// Play the browser: follow the redirect back to the loopback server.
+			u, _ := url.Parse(authURL)
+			q := u.Query()
+			challenge, redirectURI = q.Get("code_challenge"), q.Get("redirect_uri")
+			go func() {
+				cb := redirectURI + "?" + url.Values{"code": {"the-code"}, "state": {q.Get("state")}}.Encode()
+				if resp, err := http.Get(cb); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Provider != "openai" || cred.Refresh != "refresh-1" || cred.AccountID != "acct-1" || cred.Email != "dev@example.com" {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+	if cred.Expires <= time.Now().UnixMilli() {
+		t.Fatal("expected a future expiry")
+	}
+
+	refreshed, err := o.RefreshTokenContext(ctx, cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Access != "access-2" || refreshed.Refresh != "refresh-1" || refreshed.AccountID != "acct-1" {
+		t.Fatalf("refresh lost fields: %+v", refreshed)
+	}
+}
+
+func TestOpenAILoginFallsBackToPrompt(t *testing.T) {
+	// Hold the callback port so the loopback server cannot start.
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access-" + r.PostForm.Get("code"), "refresh_token": "r", "expires_in": 60})
+	}))
+	defer srv.Close()
+
+	var state string
+	o := &OpenAI{TokenURL: srv.URL, CallbackAddr: busy.Addr().String()}
+	cred, err := o.Login(aiauth.LoginCallbacks{
+		OnAuthURL: func(authURL string) error {
+			u, _ := url.Parse(authURL)
+			state = u.Query().Get("state")
+			return nil
+		},
+		OnPrompt: func(string) (string, error) {
+			return "http://localhost:1455/auth/callback?code=pasted&state=" + state, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Access != "access-pasted" {
+		t.Fatalf("expected the pasted code to be exchanged, got %+v", cred)
+	}
+}
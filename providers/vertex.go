@@ -0,0 +1,232 @@
+package providers
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kayushkin/aiauth"
+)
+
+// Service-account auth for Vertex AI, using the OAuth 2.0 JWT bearer grant.
+const (
+	VertexScopes   = "https://www.googleapis.com/auth/cloud-platform"
+	jwtBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// vertexTokenLifetime is the lifetime requested for minted tokens, the
+	// most Google allows.
+	vertexTokenLifetime = time.Hour
+)
+
+// Vertex implements the aiauth.Provider and aiauth.ContextProvider
+// interfaces for service_account credentials: RefreshToken signs a JWT
+// assertion with the service account's private key and exchanges it for an
+// access token, which the store caches on the profile until it is about to
+// expire. Login reads a key file whose path is given at the prompt.
+type Vertex struct {
+	// HTTPClient is used for token requests. Defaults to a client with
+	// DefaultHTTPTimeout.
+	HTTPClient *http.Client
+	// TokenURL overrides the token_uri in the key.
+	TokenURL string
+	// Scopes overrides VertexScopes.
+	Scopes string
+}
+
+func NewVertex() *Vertex { return &Vertex{} }
+
+func (v *Vertex) ID() string { return "vertex" }
+
+func (v *Vertex) client() *http.Client {
+	if v.HTTPClient != nil {
+		return v.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+func (v *Vertex) scopes() string {
+	if v.Scopes != "" {
+		return v.Scopes
+	}
+	return VertexScopes
+}
+
+// serviceAccountKey is the part of a Google service-account JSON key used
+// to mint tokens.
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func parseServiceAccountKey(keyJSON []byte) (*serviceAccountKey, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	switch {
+	case key.Type != "service_account":
+		return nil, fmt.Errorf("invalid service account key: type is %q, want service_account", key.Type)
+	case key.ClientEmail == "" || key.PrivateKey == "":
+		return nil, errors.New("invalid service account key: missing client_email or private_key")
+	}
+	return &key, nil
+}
+
+// ServiceAccountCredential returns a vertex service_account credential for
+// a Google service-account JSON key, with the account's email and project
+// recorded. No token is minted until the credential is first resolved.
+func ServiceAccountCredential(keyJSON []byte) (*aiauth.Credential, error) {
+	key, err := parseServiceAccountKey(keyJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &aiauth.Credential{
+		Type:           "service_account",
+		Provider:       "vertex",
+		Email:          key.ClientEmail,
+		ProjectID:      key.ProjectID,
+		ServiceAccount: string(keyJSON),
+	}, nil
+}
+
+func (v *Vertex) Login(cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	return v.LoginContext(context.Background(), cb)
+}
+
+// LoginContext asks for the path to a service-account key file and checks
+// that it can mint a token.
+func (v *Vertex) LoginContext(ctx context.Context, cb aiauth.LoginCallbacks) (*aiauth.Credential, error) {
+	if cb.OnPrompt == nil {
+		return nil, errors.New("service account login needs an OnPrompt callback")
+	}
+	path, err := cb.OnPrompt("Path to the service account JSON key:")
+	if err != nil {
+		return nil, err
+	}
+	keyJSON, err := os.ReadFile(strings.TrimSpace(path))
+	if err != nil {
+		return nil, err
+	}
+	cred, err := ServiceAccountCredential(keyJSON)
+	if err != nil {
+		return nil, err
+	}
+	return v.RefreshTokenContext(ctx, cred)
+}
+
+func (v *Vertex) RefreshToken(cred *aiauth.Credential) (*aiauth.Credential, error) {
+	return v.RefreshTokenContext(context.Background(), cred)
+}
+
+// RefreshTokenContext mints a new access token for a service_account
+// credential.
+func (v *Vertex) RefreshTokenContext(ctx context.Context, cred *aiauth.Credential) (*aiauth.Credential, error) {
+	if cred.ServiceAccount == "" {
+		return nil, fmt.Errorf("no service account key available")
+	}
+	key, err := parseServiceAccountKey([]byte(cred.ServiceAccount))
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := key.TokenURI
+	if v.TokenURL != "" {
+		tokenURL = v.TokenURL
+	}
+	if tokenURL == "" {
+		tokenURL = GoogleTokenURL
+	}
+
+	assertion, err := v.assertion(key, tokenURL, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type": {jwtBearerGrant},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "aiauth/1.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("token request returned %d: %s", resp.StatusCode, body)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response had no access token")
+	}
+
+	minted := *cred
+	minted.Access = tokenResp.AccessToken
+	minted.Expires = time.Now().UnixMilli() + tokenResp.ExpiresIn*1000 - 5*60*1000
+	return &minted, nil
+}
+
+// assertion builds the signed RS256 JWT exchanged for an access token.
+func (v *Vertex) assertion(key *serviceAccountKey, audience string, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account key: private_key is not PEM")
+	}
+	var priv *rsa.PrivateKey
+	if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("invalid service account key: private_key is not RSA")
+		}
+		priv = rk
+	} else if priv, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return "", fmt.Errorf("invalid service account key: %w", err)
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": key.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   key.ClientEmail,
+		"scope": v.scopes(),
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(vertexTokenLifetime).Unix(),
+	})
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,89 @@
+package providers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kayushkin/aiauth"
+)
+
+func TestVertexServiceAccount(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+
+	var exchanges atomic.Int32
+	var tokenURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if r.PostForm.Get("grant_type") != jwtBearerGrant || len(parts) != 3 {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		var claims struct {
+			Iss, Aud, Scope string
+		}
+		decodeJWTClaims(r.PostForm.Get("assertion"), &claims)
+		if rsa.VerifyPKCS1v15(&priv.PublicKey, crypto.SHA256, sum[:], sig) != nil ||
+			claims.Iss != "sa@proj.iam.gserviceaccount.com" || claims.Aud != tokenURL || claims.Scope != VertexScopes {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		exchanges.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "ya29.minted", "expires_in": 3600})
+	}))
+	defer srv.Close()
+	tokenURL = srv.URL
+
+	keyJSON, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "proj",
+		"private_key_id": "kid-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "sa@proj.iam.gserviceaccount.com",
+		"token_uri":      srv.URL,
+	})
+	cred, err := ServiceAccountCredential(keyJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred.Email != "sa@proj.iam.gserviceaccount.com" || cred.ProjectID != "proj" {
+		t.Fatalf("unexpected credential %+v", cred)
+	}
+
+	aiauth.RegisterContextProvider(NewVertex())
+	store, _ := aiauth.OpenStore(aiauth.NewMemoryBackend())
+	store.SetProfile("vertex:prod", cred)
+	for range 2 {
+		res, err := store.Resolve("vertex")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Secret != "ya29.minted" || res.Scheme != aiauth.SchemeBearer || res.ProjectID != "proj" {
+			t.Fatalf("unexpected resolution %+v", res)
+		}
+	}
+	if n := exchanges.Load(); n != 1 {
+		t.Fatalf("expected the minted token to be cached, got %d exchanges", n)
+	}
+
+	if _, err := ServiceAccountCredential([]byte(`{"type":"authorized_user"}`)); err == nil {
+		t.Fatal("expected a non-service-account key to be rejected")
+	}
+}
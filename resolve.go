@@ -1,105 +1,516 @@
 package aiauth
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 )
 
-// providerEnvVars maps provider names to their environment variable names.
-var providerEnvVars = map[string]string{
-	"anthropic": "ANTHROPIC_API_KEY",
-	"openai":    "OPENAI_API_KEY",
-	"google":    "GOOGLE_API_KEY",
-	"cohere":    "COHERE_API_KEY",
+// providerEnvVars maps provider names to their environment variable names,
+// in the order they are checked.
+var providerEnvVars = map[string][]string{
+	"anthropic": {"ANTHROPIC_API_KEY"},
+	"openai":    {"OPENAI_API_KEY"},
+	"google":    {"GOOGLE_API_KEY", "GEMINI_API_KEY"},
+	"cohere":    {"COHERE_API_KEY"},
+	"azure":     {"AZURE_OPENAI_API_KEY"},
 }
 
-// RegisterProviderEnvVar registers an env var name for a provider.
-func RegisterProviderEnvVar(provider, envVar string) {
-	providerEnvVars[provider] = envVar
+// AzureEndpointEnvVar names the Azure OpenAI resource endpoint used with a
+// key from AZURE_OPENAI_API_KEY.
+const AzureEndpointEnvVar = "AZURE_OPENAI_ENDPOINT"
+
+// RegisterProviderEnvVar registers the env var names for a provider,
+// replacing any registered before. The first one set wins.
+func RegisterProviderEnvVar(provider string, envVars ...string) {
+	providerEnvVars[provider] = envVars
 }
 
 // providerRegistry holds registered providers for token refresh.
-var providerRegistry = map[string]Provider{}
+var providerRegistry = map[string]ContextProvider{}
 
 // RegisterProvider registers a provider for use in token refresh.
 func RegisterProvider(p Provider) {
+	providerRegistry[p.ID()] = AdaptProvider(p)
+}
+
+// RegisterContextProvider registers a context-aware provider for use in
+// token refresh.
+func RegisterContextProvider(p ContextProvider) {
 	providerRegistry[p.ID()] = p
 }
 
+// AuthScheme is how a resolved secret is presented to the provider's API.
+type AuthScheme string
+
+const (
+	SchemeAPIKey AuthScheme = "api_key" // the provider's API key header (x-api-key for Anthropic, api-key for Azure)
+	SchemeBearer AuthScheme = "bearer"  // Authorization: Bearer
+	SchemeSigV4  AuthScheme = "sigv4"   // AWS Signature Version 4 with Resolution.AWS; see SigV4Transport
+)
+
+// Resolution describes the credential picked for a provider.
+type Resolution struct {
+	Provider  string
+	Secret    string
+	Scheme    AuthScheme
+	Profile   string // profile the secret came from; empty for env vars
+	EnvVar    string // env var the secret came from; empty for profiles
+	File      string // shared credentials file the secret came from, as "path [profile]"
+	Type      string // "api_key", "token", "oauth", "service_account", "client_credentials", "aws"
+	Expires   int64  // unix ms; 0 if unknown or non-expiring
+	Email     string
+	AccountID string // provider account the credential belongs to, if known
+	ProjectID string // cloud project requests should name, if known
+
+	// Deployment metadata, for providers such as Azure that serve models
+	// from per-customer endpoints.
+	Endpoint   string
+	Deployment string
+	APIVersion string
+
+	// AWS holds the keys for SchemeSigV4; Secret is then the secret access
+	// key alone.
+	AWS *AWSCredentials
+}
+
+// Source returns the env var, file or profile name the secret came from.
+func (r *Resolution) Source() string {
+	if r.EnvVar != "" {
+		return r.EnvVar
+	}
+	if r.File != "" {
+		return r.File
+	}
+	return r.Profile
+}
+
 // ResolveKey returns a valid API key for the given provider.
-// Priority: env var → oauth (auto-refresh if expired) → token → api_key
+// Default priority: env var → oauth (auto-refresh if expired) → token →
+// api_key; a provider's Policy can change it.
 func (s *Store) ResolveKey(provider string) (string, error) {
-	// 1. Check env var
-	if envName, ok := providerEnvVars[provider]; ok {
-		if val := os.Getenv(envName); val != "" {
-			return val, nil
+	return s.ResolveKeyContext(context.Background(), provider)
+}
+
+// ResolveKeyContext is ResolveKey with a context that bounds any token
+// refresh and the wait for the store lock.
+func (s *Store) ResolveKeyContext(ctx context.Context, provider string) (string, error) {
+	res, err := s.ResolveContext(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	return res.Secret, nil
+}
+
+// Resolve is ResolveKey returning the full Resolution: which credential was
+// used and how its secret must be presented.
+func (s *Store) Resolve(provider string) (*Resolution, error) {
+	return s.ResolveContext(context.Background(), provider)
+}
+
+// ResolveContext is Resolve with a context that bounds any token refresh and
+// the wait for the store lock.
+func (s *Store) ResolveContext(ctx context.Context, provider string) (*Resolution, error) {
+	return s.resolve(ctx, provider, nil)
+}
+
+// resolve picks the credential for provider. With a non-nil ex every
+// candidate is recorded in it, candidates after the winner are listed rather
+// than returned early, and usage is not recorded.
+func (s *Store) resolve(ctx context.Context, provider string, ex *Explanation) (*Resolution, error) {
+	note := func(c Candidate) {
+		if ex != nil {
+			ex.Candidates = append(ex.Candidates, c)
+		}
+	}
+	if s.policyErr != nil {
+		return nil, s.policyErr
+	}
+	policy := s.Policy(provider)
+	var won *Resolution
+
+	// 1. Check env var, unless the policy defers or ignores it
+	envNames := providerEnvVars[provider]
+	if awsProviders[provider] {
+		envNames = []string{AWSAccessKeyIDEnvVar}
+	}
+	hasEnv := len(envNames) > 0
+	tryEnv := func() {
+		if awsProviders[provider] {
+			var cands []Candidate
+			won, cands = resolveAWSEnv(provider)
+			for _, c := range cands {
+				note(c)
+			}
+			return
+		}
+		for _, envName := range envNames {
+			switch val := os.Getenv(envName); {
+			case won != nil:
+				note(Candidate{EnvVar: envName, Reason: "lower priority than " + won.Source()})
+			case val != "":
+				won = envResolution(provider, envName, val)
+				note(Candidate{EnvVar: envName, Type: won.Type, Selected: true})
+			default:
+				note(Candidate{EnvVar: envName, Reason: "not set"})
+			}
+		}
+	}
+	noteEnv := func(reason string) {
+		for _, envName := range envNames {
+			note(Candidate{EnvVar: envName, Reason: reason})
+		}
+	}
+	if hasEnv {
+		switch policy.envMode() {
+		case EnvFirst:
+			tryEnv()
+			if won != nil && ex == nil {
+				return won, nil
+			}
+		case EnvNever:
+			noteEnv("ignored by policy")
 		}
 	}
 
-	// 2. Get profiles ordered by priority
-	creds := s.ProfilesForProvider(provider)
-	if len(creds) == 0 {
-		return "", fmt.Errorf("no credentials found for provider %q", provider)
+	// 2. Get profiles ordered by policy
+	profiles := s.providerProfiles(provider)
+	noteExcluded := func() {
+		if ex != nil {
+			for _, np := range s.excludedProfiles(provider) {
+				note(Candidate{Profile: np.Name, Type: np.Type, Reason: "excluded by policy"})
+			}
+		}
+	}
+	if len(profiles) == 0 && won == nil && (!hasEnv || policy.envMode() != EnvLast) {
+		noteExcluded()
+		return nil, fmt.Errorf("no credentials found for provider %q", provider)
 	}
 
 	now := time.Now().UnixMilli()
 
-	for _, c := range creds {
-		switch c.Type {
-		case "oauth":
-			key := c.Access
-			if key == "" {
-				continue
+	for _, np := range profiles {
+		cand := Candidate{Profile: np.Name, Type: np.Type}
+		if won != nil {
+			cand.Reason = "lower priority than " + won.Source()
+			note(cand)
+			continue
+		}
+		res, reason, err := s.tryProfile(ctx, provider, np, now)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		cand.Reason, cand.Err = reason, err
+		cand.Selected = res != nil
+		note(cand)
+		won = res
+		if won != nil && ex == nil {
+			break
+		}
+	}
+
+	if hasEnv && policy.envMode() == EnvLast {
+		if won == nil {
+			tryEnv()
+		} else {
+			noteEnv("lower priority than " + won.Source())
+		}
+	}
+	noteExcluded()
+
+	if won == nil {
+		return nil, fmt.Errorf("no valid credentials for provider %q", provider)
+	}
+	if ex == nil && won.Profile != "" {
+		s.markUsed(ctx, provider, won.Profile)
+	}
+	return won, nil
+}
+
+// tryProfile checks whether a profile is usable, refreshing an expired oauth
+// token if a provider is registered. It returns the resolution, or why the
+// profile was skipped along with any refresh error.
+func (s *Store) tryProfile(ctx context.Context, provider string, np NamedCredential, now int64) (*Resolution, string, error) {
+	c := &np.Credential
+	if reason := s.cooldownReason(np.Name, now); reason != "" {
+		return nil, reason, nil
+	}
+	switch c.Type {
+	case "oauth":
+		if c.Access == "" {
+			return nil, "empty access token", nil
+		}
+		// Check expiry and refresh if needed
+		if c.Expires > 0 && c.Expires < now {
+			p, ok := providerRegistry[provider]
+			if !ok {
+				return nil, "expired and no provider registered to refresh it", nil
 			}
-			// Check expiry and refresh if needed
-			if c.Expires > 0 && c.Expires < now {
-				if p, ok := providerRegistry[provider]; ok {
-					refreshed, err := p.RefreshToken(c)
-					if err != nil {
-						continue // try next credential
-					}
-					name := s.FindProfileName(c)
-					_ = s.UpdateProfile(name, refreshed)
-					key = refreshed.Access
-
-					// Sync to <provider>:manual for OpenClaw compatibility
-					manualName := provider + ":manual"
-					if _, exists := s.data.Profiles[manualName]; exists {
-						manualCred := &Credential{
-							Type:     "token",
-							Provider: provider,
-							Token:    refreshed.Access,
-							Expires:  refreshed.Expires,
-							Email:    refreshed.Email,
-						}
-						_ = s.UpdateProfile(manualName, manualCred)
-					}
-				} else {
-					continue // expired and no provider to refresh
-				}
+			refreshed, err := s.refreshShared(ctx, np.Name, p, 0)
+			if err != nil {
+				return nil, "refresh failed", err
 			}
-			return key, nil
+			c = refreshed
+		}
+		return profileResolution(np.Name, c, c.Access, SchemeBearer), "", nil
 
-		case "token":
-			if c.Token == "" {
-				continue
+	case "service_account", "client_credentials":
+		switch {
+		case c.Type == "service_account" && c.ServiceAccount == "":
+			return nil, "empty service account key", nil
+		case c.Type == "client_credentials" && (c.ClientID == "" || c.ClientSecret == ""):
+			return nil, "empty client id or secret", nil
+		}
+		// The cached access token is minted again once it expires.
+		if c.Access == "" || (c.Expires > 0 && c.Expires < now) {
+			p, ok := providerRegistry[provider]
+			if !ok {
+				return nil, "no cached token and no provider registered to mint one", nil
 			}
-			if c.Expires > 0 && c.Expires < now {
-				continue // expired
+			minted, err := s.refreshShared(ctx, np.Name, p, 0)
+			if err != nil {
+				return nil, "token exchange failed", err
 			}
-			return c.Token, nil
+			c = minted
+		}
+		return profileResolution(np.Name, c, c.Access, SchemeBearer), "", nil
 
-		case "api_key":
-			if c.Key == "" {
-				continue
-			}
-			return c.Key, nil
+	case "token":
+		if c.Token == "" {
+			return nil, "empty token", nil
+		}
+		if c.Expires > 0 && c.Expires < now {
+			return nil, "expired " + time.UnixMilli(c.Expires).Format(time.RFC3339), nil
+		}
+		return profileResolution(np.Name, c, c.Token, SchemeBearer), "", nil
+
+	case "aws":
+		if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return nil, "empty access key", nil
+		}
+		if c.Expires > 0 && c.Expires < now {
+			return nil, "expired " + time.UnixMilli(c.Expires).Format(time.RFC3339), nil
 		}
+		// A profile without a region signs for the one the SDKs would use.
+		region := c.Region
+		if region == "" {
+			region = awsRegion()
+		}
+		res := awsResolution(provider, &AWSCredentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			Region:          region,
+		})
+		res.Profile, res.Expires, res.Email = np.Name, c.Expires, c.Email
+		return res, "", nil
+
+	case "api_key":
+		if c.Key == "" {
+			return nil, "empty key", nil
+		}
+		return profileResolution(np.Name, c, c.Key, SchemeAPIKey), "", nil
 	}
+	return nil, fmt.Sprintf("unsupported type %q", c.Type), nil
+}
 
-	return "", fmt.Errorf("no valid credentials for provider %q", provider)
+func profileResolution(name string, c *Credential, secret string, scheme AuthScheme) *Resolution {
+	return &Resolution{
+		Provider:  c.Provider,
+		Secret:    secret,
+		Scheme:    scheme,
+		Profile:   name,
+		Type:      c.Type,
+		Expires:   c.Expires,
+		Email:     c.Email,
+		AccountID: c.AccountID,
+		ProjectID: c.ProjectID,
+
+		Endpoint:   c.Endpoint,
+		Deployment: c.Deployment,
+		APIVersion: c.APIVersion,
+	}
+}
+
+// envResolution builds the Resolution for a secret taken from an env var.
+// Env vars carry no type, so this is the one place the secret's format is
+// sniffed: Anthropic OAuth tokens (sk-ant-oat01-*) need Bearer auth. An Azure
+// key is paired with its endpoint from AZURE_OPENAI_ENDPOINT.
+func envResolution(provider, envName, val string) *Resolution {
+	res := &Resolution{
+		Provider: provider,
+		Secret:   val,
+		Scheme:   SchemeAPIKey,
+		EnvVar:   envName,
+		Type:     "api_key",
+	}
+	if provider == "anthropic" && strings.HasPrefix(val, "sk-ant-oat") {
+		res.Scheme = SchemeBearer
+		res.Type = "token"
+	}
+	if provider == "azure" {
+		res.Endpoint = os.Getenv(AzureEndpointEnvVar)
+	}
+	return res
+}
+
+// lastUsedFlushInterval throttles LastUsed writes so resolving a key does
+// not rewrite the store on every call.
+const lastUsedFlushInterval = time.Minute
+
+// markUsedTimeout bounds how long resolution waits for the store lock just
+// to record usage; the bookkeeping is skipped if the lock is busy.
+const markUsedTimeout = 250 * time.Millisecond
+
+// cooldownReason describes a profile's failure cooldown at now, or returns
+// "" if it is usable.
+func (s *Store) cooldownReason(name string, now int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.data.UsageStats[name]
+	switch {
+	case st == nil:
+		return ""
+	case now < st.DisabledUntil:
+		reason := "disabled until " + time.UnixMilli(st.DisabledUntil).Format(time.RFC3339)
+		if st.DisabledReason != "" {
+			reason += " (" + st.DisabledReason + ")"
+		}
+		return reason
+	case now < st.CooldownUntil:
+		return "cooling down until " + time.UnixMilli(st.CooldownUntil).Format(time.RFC3339)
+	}
+	return ""
+}
+
+// markUsed records that a profile was just used: it becomes the provider's
+// LastGood and its LastUsed is updated, as OpenClaw does.
+func (s *Store) markUsed(ctx context.Context, provider, name string) {
+	now := time.Now().UnixMilli()
+	s.mu.Lock()
+	st := s.data.UsageStats[name]
+	recent := s.data.LastGood[provider] == name && st != nil && now-st.LastUsed < lastUsedFlushInterval.Milliseconds()
+	s.mu.Unlock()
+	if recent {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, markUsedTimeout)
+	defer cancel()
+	_ = s.update(ctx, func(data *AuthStore) error {
+		if _, ok := data.Profiles[name]; !ok {
+			return errNoChange
+		}
+		if data.LastGood == nil {
+			data.LastGood = make(map[string]string)
+		}
+		data.LastGood[provider] = name
+		data.stats(name).LastUsed = now
+		return nil
+	})
+}
+
+// RefreshProfile refreshes the named oauth profile, or mints a new token for
+// the named service_account or client_credentials profile, with p and saves
+// the result, regardless of whether the current access token has expired.
+func (s *Store) RefreshProfile(name string, p Provider) (*Credential, error) {
+	return s.RefreshProfileContext(context.Background(), name, AdaptProvider(p))
+}
+
+// RefreshProfileContext is RefreshProfile with a context.
+func (s *Store) RefreshProfileContext(ctx context.Context, name string, p ContextProvider) (*Credential, error) {
+	return s.refreshProfile(ctx, name, p, -1)
+}
+
+// sharedRefreshTimeout bounds a shared refresh, which no single caller's
+// deadline applies to, so a hung token endpoint cannot hold the store's
+// writer lock indefinitely.
+var sharedRefreshTimeout = time.Minute
+
+// refreshShared refreshes an expired profile, coalescing concurrent callers
+// in this process so exactly one refresh runs per profile and every waiter
+// gets its result. The shared refresh is detached from any single caller's
+// cancellation and bounded by sharedRefreshTimeout instead; each caller
+// stops waiting when its own ctx is done.
+func (s *Store) refreshShared(ctx context.Context, name string, p ContextProvider, window time.Duration) (*Credential, error) {
+	ch := s.refreshes.DoChan(name, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedRefreshTimeout)
+		defer cancel()
+		return s.refreshProfile(ctx, name, p, window)
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*Credential), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refreshProfile refreshes an oauth profile under the store lock. The profile
+// is re-read from disk once the lock is held; a token that is still valid for
+// more than window (for example because another process already refreshed
+// it) is returned as-is instead of spending the single-use refresh token
+// again. A negative window forces the refresh.
+func (s *Store) refreshProfile(ctx context.Context, name string, p ContextProvider, window time.Duration) (*Credential, error) {
+	var result *Credential
+	err := s.update(ctx, func(data *AuthStore) error {
+		cur, ok := data.Profiles[name]
+		if !ok || (cur.Type != "oauth" && cur.Type != "service_account" && cur.Type != "client_credentials") {
+			return fmt.Errorf("no oauth, service_account or client_credentials profile %q", name)
+		}
+		if window >= 0 && cur.Access != "" && (cur.Expires == 0 || cur.Expires-time.Now().UnixMilli() > window.Milliseconds()) {
+			result = cur
+			return errNoChange
+		}
+
+		fresh, err := p.RefreshTokenContext(ctx, cur)
+		if err != nil {
+			return err
+		}
+		// Providers build the credential from scratch; apply its token to a
+		// copy of the stored one so fields they don't know about survive.
+		refreshed := new(Credential)
+		*refreshed = *cur
+		refreshed.Access, refreshed.Expires = fresh.Access, fresh.Expires
+		if fresh.Refresh != "" {
+			refreshed.Refresh = fresh.Refresh
+		}
+		if fresh.Email != "" {
+			refreshed.Email = fresh.Email
+		}
+		if fresh.AccountID != "" {
+			refreshed.AccountID = fresh.AccountID
+		}
+		if fresh.ProjectID != "" {
+			refreshed.ProjectID = fresh.ProjectID
+		}
+		data.Profiles[name] = refreshed
+
+		// Sync to <provider>:manual for OpenClaw compatibility, keeping
+		// whatever else OpenClaw recorded on it.
+		manualName := cur.Provider + ":manual"
+		if manual, exists := data.Profiles[manualName]; exists && cur.Type == "oauth" {
+			synced := new(Credential)
+			*synced = *manual
+			synced.Type, synced.Provider = "token", cur.Provider
+			synced.Token, synced.Expires, synced.Email = refreshed.Access, refreshed.Expires, refreshed.Email
+			data.Profiles[manualName] = synced
+		}
+		result = refreshed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// result is the stored profile; callers and singleflight waiters get
+	// their own copy.
+	cp := *result
+	return &cp, nil
 }
 
 // AnthropicKey is a convenience for ResolveKey("anthropic").
@@ -0,0 +1,195 @@
+package aiauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SchemaVersion is the auth-profiles.json schema version this package
+// reads and writes. Older files are migrated on load and written back at
+// this version; newer files can be read but not written.
+const SchemaVersion = 1
+
+// SchemaVersionError is returned when saving a store that was written by a
+// newer schema version, which this package would silently downgrade.
+type SchemaVersionError struct {
+	Version   int // version of the file
+	Supported int // SchemaVersion
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("auth store schema version %d is newer than supported version %d; refusing to overwrite it", e.Version, e.Supported)
+}
+
+// Migration upgrades a store document by one schema version, in place. The
+// document is the top-level JSON object; its "version" is updated by the
+// caller.
+type Migration func(doc map[string]json.RawMessage) error
+
+var migrations = map[int]Migration{
+	// Files written before the version field existed have the version 1
+	// layout.
+	0: func(doc map[string]json.RawMessage) error { return nil },
+}
+
+// RegisterMigration registers the migration from schema version from to
+// from+1.
+func RegisterMigration(from int, m Migration) {
+	migrations[from] = m
+}
+
+// migrate upgrades raw to SchemaVersion using the registered migrations.
+// Documents at or above SchemaVersion are returned unchanged.
+func migrate(raw []byte) ([]byte, error) {
+	var head struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return nil, err
+	}
+	if head.Version >= SchemaVersion {
+		return raw, nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for v := head.Version; v < SchemaVersion; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, fmt.Errorf("no migration from auth store schema version %d", v)
+		}
+		if err := m(doc); err != nil {
+			return nil, fmt.Errorf("migrate auth store from version %d: %w", v, err)
+		}
+		doc["version"] = json.RawMessage(fmt.Sprint(v + 1))
+	}
+	return json.Marshal(doc)
+}
+
+// The on-disk types keep JSON fields they do not know about, for example
+// ones added by a newer OpenClaw, so that a load-modify-save round trip
+// does not drop them. Unknown fields are held as a JSON object in a string
+// so the types stay comparable and cheap to copy.
+
+func (a *AuthStore) UnmarshalJSON(b []byte) error {
+	type plain AuthStore
+	if err := json.Unmarshal(b, (*plain)(a)); err != nil {
+		return err
+	}
+	var err error
+	a.extra, err = unknownFields(b, reflect.TypeFor[AuthStore]())
+	return err
+}
+
+func (a AuthStore) MarshalJSON() ([]byte, error) {
+	type plain AuthStore
+	b, err := json.Marshal(plain(a))
+	if err != nil {
+		return nil, err
+	}
+	return withUnknownFields(b, a.extra), nil
+}
+
+func (c *Credential) UnmarshalJSON(b []byte) error {
+	type plain Credential
+	if err := json.Unmarshal(b, (*plain)(c)); err != nil {
+		return err
+	}
+	var err error
+	c.extra, err = unknownFields(b, reflect.TypeFor[Credential]())
+	return err
+}
+
+func (c Credential) MarshalJSON() ([]byte, error) {
+	type plain Credential
+	b, err := json.Marshal(plain(c))
+	if err != nil {
+		return nil, err
+	}
+	return withUnknownFields(b, c.extra), nil
+}
+
+func (u *UsageStats) UnmarshalJSON(b []byte) error {
+	type plain UsageStats
+	if err := json.Unmarshal(b, (*plain)(u)); err != nil {
+		return err
+	}
+	var err error
+	u.extra, err = unknownFields(b, reflect.TypeFor[UsageStats]())
+	return err
+}
+
+func (u UsageStats) MarshalJSON() ([]byte, error) {
+	type plain UsageStats
+	b, err := json.Marshal(plain(u))
+	if err != nil {
+		return nil, err
+	}
+	return withUnknownFields(b, u.extra), nil
+}
+
+var knownFieldsCache sync.Map // reflect.Type → map[string]bool
+
+// knownFields returns the JSON names of t's fields.
+func knownFields(t reflect.Type) map[string]bool {
+	if v, ok := knownFieldsCache.Load(t); ok {
+		return v.(map[string]bool)
+	}
+	known := make(map[string]bool)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[name] = true
+	}
+	knownFieldsCache.Store(t, known)
+	return known
+}
+
+// unknownFields returns the fields of the JSON object b that t does not
+// declare, as a JSON object, or "" if there are none. Matching is exact, so
+// a differently-cased duplicate of a known field is kept too.
+func unknownFields(b []byte, t reflect.Type) (string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "", err
+	}
+	known := knownFields(t)
+	for name := range fields {
+		if known[name] {
+			delete(fields, name)
+		}
+	}
+	if len(fields) == 0 {
+		return "", nil
+	}
+	out, err := json.Marshal(fields)
+	return string(out), err
+}
+
+// withUnknownFields appends the fields of the JSON object extra to the JSON
+// object b.
+func withUnknownFields(b []byte, extra string) []byte {
+	if extra == "" {
+		return b
+	}
+	b = bytes.TrimSuffix(b, []byte("}"))
+	if len(b) > 1 {
+		b = append(b, ',')
+	}
+	return append(b, extra[1:]...)
+}
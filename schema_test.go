@@ -0,0 +1,162 @@
+package aiauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnknownFieldsSurviveRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	os.WriteFile(path, []byte(`{
+  "version": 1,
+  "order": {"anthropic": ["anthropic:a"]},
+  "profiles": {
+    "anthropic:a": {"type": "api_key", "provider": "anthropic", "key": "key-a", "metadata": {"label": "work"}}
+  },
+  "usageStats": {"anthropic:a": {"lastUsed": 1, "cooldownReason": "x"}}
+}`), 0600)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	var doc struct {
+		Order      map[string][]string
+		Profiles   map[string]map[string]any
+		UsageStats map[string]map[string]any
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Order["anthropic"]) != 1 {
+		t.Errorf("top-level field dropped:\n%s", raw)
+	}
+	if doc.Profiles["anthropic:a"]["metadata"] == nil || doc.Profiles["anthropic:a"]["key"] != "key-a" {
+		t.Errorf("credential field dropped:\n%s", raw)
+	}
+	if doc.UsageStats["anthropic:a"]["cooldownReason"] != "x" {
+		t.Errorf("usage stats field dropped:\n%s", raw)
+	}
+}
+
+func TestSchemaVersions(t *testing.T) {
+	dir := t.TempDir()
+
+	// Unversioned files are migrated and written back at SchemaVersion.
+	old := filepath.Join(dir, "old.json")
+	os.WriteFile(old, []byte(`{"profiles": {"anthropic:a": {"type": "api_key", "provider": "anthropic", "key": "key-a"}}}`), 0600)
+	store, err := NewStore(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := store.Profile("anthropic:a"); c.Key != "key-a" {
+		t.Fatal("profile lost in migration")
+	}
+	store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+	if raw, _ := os.ReadFile(old); !strings.Contains(string(raw), `"version": 1`) {
+		t.Fatalf("expected version to be written back:\n%s", raw)
+	}
+
+	// Newer files are readable but never overwritten.
+	newer := filepath.Join(dir, "newer.json")
+	content := []byte(`{"version": 99, "profiles": {"anthropic:a": {"type": "api_key", "provider": "anthropic", "key": "key-a"}}}`)
+	os.WriteFile(newer, content, 0600)
+	store, err = NewStore(newer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := store.Profile("anthropic:a"); c.Key != "key-a" {
+		t.Fatal("newer file should still be readable")
+	}
+	err = store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+	var verr *SchemaVersionError
+	if !errors.As(err, &verr) || verr.Version != 99 {
+		t.Fatalf("expected *SchemaVersionError, got %v", err)
+	}
+	if raw, _ := os.ReadFile(newer); string(raw) != string(content) {
+		t.Fatal("newer file was modified")
+	}
+}
+
+func TestRegisteredMigrationRuns(t *testing.T) {
+	prev := migrations[0]
+	t.Cleanup(func() { migrations[0] = prev })
+	RegisterMigration(0, func(doc map[string]json.RawMessage) error {
+		doc["profiles"] = doc["credentials"]
+		delete(doc, "credentials")
+		return nil
+	})
+
+	out, err := migrate([]byte(`{"credentials": {"anthropic:a": {"type": "api_key", "provider": "anthropic", "key": "key-a"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data AuthStore
+	if err := json.Unmarshal(out, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != SchemaVersion || data.Profiles["anthropic:a"] == nil || data.extra != "" {
+		t.Fatalf("unexpected migration result %s", out)
+	}
+}
+
+// renewingProvider returns a bare credential, as providers outside the
+// package do.
+type renewingProvider struct{}
+
+func (renewingProvider) ID() string { return "renewing" }
+
+func (renewingProvider) LoginContext(ctx context.Context, cb LoginCallbacks) (*Credential, error) {
+	return nil, errors.New("not supported")
+}
+
+func (renewingProvider) RefreshTokenContext(ctx context.Context, cred *Credential) (*Credential, error) {
+	return &Credential{Type: "oauth", Provider: "renewing", Access: "fresh", Refresh: "r2", Expires: time.Now().Add(time.Hour).UnixMilli()}, nil
+}
+
+func TestRefreshKeepsUnknownFields(t *testing.T) {
+	RegisterContextProvider(renewingProvider{})
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	os.WriteFile(path, []byte(`{
+  "version": 1,
+  "profiles": {
+    "renewing:oauth": {"type": "oauth", "provider": "renewing", "access": "stale", "refresh": "r1", "expires": 1, "metadata": {"label": "work"}},
+    "renewing:manual": {"type": "token", "provider": "renewing", "token": "stale", "expires": 1, "metadata": {"label": "manual"}}
+  }
+}`), 0600)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := store.ResolveKey("renewing"); err != nil || key != "fresh" {
+		t.Fatalf("expected a refreshed key, got %q, %v", key, err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	var doc struct {
+		Profiles map[string]map[string]any
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	p := doc.Profiles["renewing:oauth"]
+	if p["metadata"] == nil || p["refresh"] != "r2" {
+		t.Fatalf("refresh lost fields or did not apply: %v", p)
+	}
+	// So does the <provider>:manual copy it keeps in sync.
+	if m := doc.Profiles["renewing:manual"]; m["metadata"] == nil || m["token"] != "fresh" {
+		t.Fatalf("manual sync lost fields or did not apply: %v", m)
+	}
+}
@@ -0,0 +1,225 @@
+package aiauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SecretBackendEnvVar selects a registered secret backend by name. "file"
+// (or unset) keeps secrets in the store document itself.
+const SecretBackendEnvVar = "AIAUTH_SECRET_BACKEND"
+
+// secretRefPrefix marks a secret field that only holds a reference into the
+// secret backend.
+const secretRefPrefix = "keyring:"
+
+var (
+	// ErrSecretNotFound is returned by a SecretBackend for an unknown key.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrSecretBackendUnavailable is returned when a store references
+	// secrets but no secret backend is configured to resolve them.
+	ErrSecretBackendUnavailable = errors.New("store references keyring secrets but no secret backend is available")
+)
+
+// SecretBackend keeps credential secrets outside the store document. Only
+// references are written to the document; the secret values live here.
+type SecretBackend interface {
+	Get(key string) (string, error)
+	Set(key, secret string) error
+	Delete(key string) error
+}
+
+var (
+	secretBackendsMu sync.Mutex
+	secretBackends   = map[string]func() (SecretBackend, error){}
+)
+
+// RegisterSecretBackend makes a secret backend selectable by name through
+// AIAUTH_SECRET_BACKEND. open is called once per store; if it fails the
+// store falls back to keeping secrets in the document.
+func RegisterSecretBackend(name string, open func() (SecretBackend, error)) {
+	secretBackendsMu.Lock()
+	defer secretBackendsMu.Unlock()
+	secretBackends[name] = open
+}
+
+// WithSecretBackend keeps secrets in sb instead of the store document.
+func WithSecretBackend(sb SecretBackend) StoreOption {
+	return func(s *Store) { s.secrets = sb }
+}
+
+// secretBackendFromEnv opens the backend named by AIAUTH_SECRET_BACKEND.
+// It returns nil (use the document) when unset, "file", or unavailable.
+func secretBackendFromEnv() (SecretBackend, error) {
+	name := os.Getenv(SecretBackendEnvVar)
+	if name == "" || name == "file" {
+		return nil, nil
+	}
+	secretBackendsMu.Lock()
+	open, ok := secretBackends[name]
+	secretBackendsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown secret backend %q", name)
+	}
+	return open()
+}
+
+// SecretBackend returns the secret backend in use, or nil if secrets are
+// kept in the store document.
+func (s *Store) SecretBackend() SecretBackend { return s.secrets }
+
+// SecretBackendErr reports why the backend named by AIAUTH_SECRET_BACKEND
+// could not be opened, in which case the store fell back to the document.
+func (s *Store) SecretBackendErr() error { return s.secretsErr }
+
+// secretKey is the backend key for one secret field of data. The store
+// identity is part of the key so several stores can share one keyring: the
+// file path for file-backed stores, otherwise the ID saved in the document.
+func (s *Store) secretKey(data *AuthStore, profile, field string) string {
+	id := s.path
+	if id == "" {
+		id = data.ID
+	}
+	h := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(h[:6]) + "/" + profile + "/" + field
+}
+
+// storeSecrets writes the secret fields of data to the secret backend. It
+// returns a copy of the profiles holding references instead, and the keys
+// now in use with their values. A store without a path is given an ID
+// first.
+func (s *Store) storeSecrets(data *AuthStore) (map[string]*Credential, map[string]string, error) {
+	if s.path == "" && data.ID == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		data.ID = hex.EncodeToString(b)
+	}
+
+	out := make(map[string]*Credential, len(data.Profiles))
+	live := make(map[string]string)
+	for name, c := range data.Profiles {
+		cp := *c
+		for field, v := range cp.secretFields() {
+			if *v == "" || strings.HasPrefix(*v, secretRefPrefix) {
+				continue
+			}
+			key := s.secretKey(data, name, field)
+			if known, ok := s.secretCache[key]; !ok || known != *v {
+				if err := s.secrets.Set(key, *v); err != nil {
+					return nil, nil, fmt.Errorf("store secret %s %s: %w", name, field, err)
+				}
+			}
+			live[key] = *v
+			*v = secretRefPrefix + key
+		}
+		out[name] = &cp
+	}
+	return out, live, nil
+}
+
+// pruneSecrets deletes the keys in prior that neither live nor any retained
+// backup references, so Restore can still resolve every generation it can
+// roll back to. A restored generation gets each secret's latest value.
+func (s *Store) pruneSecrets(prior map[string]bool, live map[string]string) error {
+	retained, ok := s.backupSecretRefs()
+	if !ok {
+		return nil
+	}
+	var stale []string
+	for key := range prior {
+		if _, ok := live[key]; !ok && !retained[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	for _, key := range stale {
+		if err := s.secrets.Delete(key); err != nil && !errors.Is(err, ErrSecretNotFound) {
+			return fmt.Errorf("delete secret %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// backupSecretRefs returns the keys referenced by the backend's backups. It
+// reports false if a backup cannot be read, e.g. one encrypted with an
+// older key, in which case no key may be assumed unreferenced.
+func (s *Store) backupSecretRefs() (map[string]bool, bool) {
+	refs := make(map[string]bool)
+	bb, ok := s.backend.(BackupBackend)
+	if !ok {
+		return refs, true
+	}
+	backups, err := bb.Backups()
+	if err != nil {
+		return nil, false
+	}
+	for _, b := range backups {
+		raw, err := bb.LoadBackup(b.Generation)
+		if err != nil {
+			return nil, false
+		}
+		if raw, err = migrate(raw); err != nil {
+			return nil, false
+		}
+		var data AuthStore
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, false
+		}
+		if data.Encryption != nil {
+			if s.key == nil || s.keySalt != data.Encryption.Salt {
+				return nil, false
+			}
+			if err := openProfiles(s.key, data.Profiles); err != nil {
+				return nil, false
+			}
+		}
+		for _, c := range data.Profiles {
+			for _, v := range c.secretFields() {
+				if strings.HasPrefix(*v, secretRefPrefix) {
+					refs[strings.TrimPrefix(*v, secretRefPrefix)] = true
+				}
+			}
+		}
+	}
+	return refs, true
+}
+
+// loadSecrets replaces secret references in data's profiles with their
+// values.
+func (s *Store) loadSecrets(data *AuthStore) error {
+	cache := make(map[string]string)
+	for name, c := range data.Profiles {
+		for field, v := range c.secretFields() {
+			if !strings.HasPrefix(*v, secretRefPrefix) {
+				continue
+			}
+			if s.secrets == nil {
+				if s.secretsErr != nil {
+					return fmt.Errorf("%w: %v", ErrSecretBackendUnavailable, s.secretsErr)
+				}
+				return ErrSecretBackendUnavailable
+			}
+			key := strings.TrimPrefix(*v, secretRefPrefix)
+			val, err := s.secrets.Get(key)
+			if err != nil {
+				return fmt.Errorf("load secret %s %s: %w", name, field, err)
+			}
+			*v = val
+			if key == s.secretKey(data, name, field) {
+				cache[key] = val
+			}
+		}
+	}
+	s.secretCache = cache
+	return nil
+}
@@ -0,0 +1,107 @@
+package aiauth
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mapSecrets is a SecretBackend kept in a map.
+type mapSecrets struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (b *mapSecrets) Get(key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.m[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return v, nil
+}
+
+func (b *mapSecrets) Set(key, secret string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.m[key] = secret
+	return nil
+}
+
+func (b *mapSecrets) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.m, key)
+	return nil
+}
+
+func (b *mapSecrets) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.m)
+}
+
+func TestSecretsKeptForBackups(t *testing.T) {
+	sb := &mapSecrets{m: map[string]string{}}
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	store, err := NewStore(path, WithBackups(1), WithSecretBackend(sb))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteProfile("anthropic:a"); err != nil {
+		t.Fatal(err)
+	}
+	if sb.len() != 1 {
+		t.Fatalf("expected the removed profile's secret kept for the backup, got %d", sb.len())
+	}
+	if err := store.Restore(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Profiles()["anthropic:a"].Key; got != "key-a" {
+		t.Fatalf("expected key-a after restore, got %q", got)
+	}
+
+	// Once no generation references it, the secret is deleted.
+	if err := store.DeleteProfile("anthropic:a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"}); err != nil {
+		t.Fatal(err)
+	}
+	if sb.len() != 1 {
+		t.Fatalf("expected only anthropic:b's secret left, got %d", sb.len())
+	}
+}
+
+func TestSecretKeysStableWithoutPath(t *testing.T) {
+	sb := &mapSecrets{m: map[string]string{}}
+	b := NewMemoryBackend()
+	s1, _ := OpenStore(b, WithSecretBackend(sb))
+	if err := s1.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A store opened on the same backend, as by another process, takes the
+	// ID from the document, so updating the secret replaces it.
+	s2, err := OpenStore(b, WithSecretBackend(sb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a2"}); err != nil {
+		t.Fatal(err)
+	}
+	if sb.len() != 1 {
+		t.Fatalf("expected one secret, got %d", sb.len())
+	}
+
+	raw, _ := b.Load()
+	if !strings.Contains(string(raw), `"id"`) {
+		t.Fatal("expected the store ID in the document")
+	}
+}
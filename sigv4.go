@@ -0,0 +1,219 @@
+package aiauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// SignSigV4 signs req in place with AWS Signature Version 4 for service,
+// in creds.Region, at now. It signs the host, Content-Type and X-Amz-*
+// headers and the body, which it reads and restores.
+func SignSigV4(req *http.Request, creds *AWSCredentials, service string, now time.Time) error {
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return errors.New("sigv4: missing AWS access key")
+	}
+	if creds.Region == "" {
+		return errors.New("sigv4: no AWS region")
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return fmt.Errorf("sigv4: read body: %w", err)
+	}
+	payloadHash := sha256.Sum256(body)
+
+	now = now.UTC()
+	amzDate := now.Format(sigV4TimeFormat)
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, vals := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(vals))
+			for i, v := range vals {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			headers[lower] = strings.Join(trimmed, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, name := range names {
+		canonHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		canonicalURI(req),
+		canonicalQuery(req),
+		canonHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := date + "/" + creds.Region + "/" + service + "/aws4_request"
+	stringToSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, creds.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// readBody returns req's body and leaves req with an unread copy.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	return body, nil
+}
+
+// canonicalURI is the request path URI-encoded twice, once as sent and once
+// more for signing, as every service but S3 expects.
+func canonicalURI(req *http.Request) string {
+	path := req.URL.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	return awsEscape(path, false)
+}
+
+func canonicalQuery(req *http.Request) string {
+	q := req.URL.Query()
+	pairs := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes every byte except the RFC 3986 unreserved
+// characters, and '/' unless escapeSlash is set.
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// SigV4Transport is an http.RoundTripper that signs each request with the
+// AWS credentials resolved from Store for Provider, so rotated or refreshed
+// credentials are picked up without rebuilding the client.
+type SigV4Transport struct {
+	Store *Store
+	// Provider to resolve. Defaults to "bedrock".
+	Provider string
+	// Service is the SigV4 signing name. Defaults to "bedrock".
+	Service string
+	// Region overrides the region resolved with the credentials.
+	Region string
+	// Base sends the signed request. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *SigV4Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := t.Provider
+	if provider == "" {
+		provider = "bedrock"
+	}
+	service := t.Service
+	if service == "" {
+		service = "bedrock"
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// RoundTrippers must close the body even on error.
+	fail := func(err error) (*http.Response, error) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	res, err := t.Store.ResolveContext(req.Context(), provider)
+	if err != nil {
+		return fail(err)
+	}
+	if res.AWS == nil {
+		return fail(fmt.Errorf("sigv4: %s resolved to a %s credential, not aws", res.Source(), res.Type))
+	}
+	creds := *res.AWS
+	if t.Region != "" {
+		creds.Region = t.Region
+	}
+
+	// RoundTrippers must not modify the caller's request.
+	signed := req.Clone(req.Context())
+	if err := SignSigV4(signed, &creds, service, time.Now()); err != nil {
+		return fail(err)
+	}
+	return base.RoundTrip(signed)
+}
@@ -1,11 +1,19 @@
 package aiauth
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
+	"maps"
 	"os"
-	"path/filepath"
+	"slices"
+	"sort"
 	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // AuthStore is the on-disk format for auth-profiles.json.
@@ -14,6 +22,12 @@ type AuthStore struct {
 	Profiles   map[string]*Credential    `json:"profiles"`
 	LastGood   map[string]string         `json:"lastGood,omitempty"`
 	UsageStats map[string]*UsageStats    `json:"usageStats,omitempty"`
+	Encryption *Encryption               `json:"encryption,omitempty"`
+	// ID names the store in a shared secret backend when it has no file
+	// path to go by. It is generated on the first save that needs it.
+	ID         string                    `json:"id,omitempty"`
+
+	extra string // unknown JSON fields, kept on round trip
 }
 
 // UsageStats tracks per-profile usage.
@@ -21,128 +35,684 @@ type UsageStats struct {
 	LastUsed      int64 `json:"lastUsed,omitempty"`
 	ErrorCount    int   `json:"errorCount,omitempty"`
 	LastFailureAt int64 `json:"lastFailureAt,omitempty"`
+	CooldownUntil int64 `json:"cooldownUntil,omitempty"` // unix ms; skipped until then
+	DisabledUntil int64 `json:"disabledUntil,omitempty"` // unix ms; longer-lived than a cooldown
+
+	DisabledReason string         `json:"disabledReason,omitempty"`
+	FailureCounts  map[string]int `json:"failureCounts,omitempty"` // consecutive failures by FailureKind
+
+	// Background refresh failures, kept apart from the API failures above.
+	RefreshErrors        int   `json:"refreshErrors,omitempty"` // consecutive
+	LastRefreshFailureAt int64 `json:"lastRefreshFailureAt,omitempty"`
+
+	extra string // unknown JSON fields, kept on round trip
+}
+
+// InCooldown reports whether the profile should be skipped at now (unix ms).
+func (u *UsageStats) InCooldown(now int64) bool {
+	return u != nil && (now < u.CooldownUntil || now < u.DisabledUntil)
+}
+
+// stats returns the UsageStats for a profile, creating it if needed.
+func (a *AuthStore) stats(name string) *UsageStats {
+	if a.UsageStats == nil {
+		a.UsageStats = make(map[string]*UsageStats)
+	}
+	st := a.UsageStats[name]
+	if st == nil {
+		st = &UsageStats{}
+		a.UsageStats[name] = st
+	}
+	return st
 }
 
 // Store manages reading/writing auth profiles.
 type Store struct {
-	mu   sync.Mutex
-	path string
-	data *AuthStore
+	mu          sync.Mutex    // guards data and the subscriber state; never held for I/O
+	writer      chan struct{} // held by the one writer or reloader in this process
+	backend     Backend
+	path        string // set when backed by a *FileBackend
+	data        *AuthStore
+	lockTimeout time.Duration
+	backups     int
+	keySource   KeySource
+	key         []byte // derived key for the envelope with salt keySalt
+	keySalt     string
+	secrets     SecretBackend
+	secretCache map[string]string // keys known to hold these values in secrets
+	secretsErr  error             // why the configured secret backend is unused
+	config      *Config
+	policies    map[string]Policy // WithPolicy overrides of config
+	policyErr   error             // invalid config or policy
+	pins        map[string]string // WithProfile pins by provider
+	discovery   *Discovery        // set by DefaultStore
+	subs        []subscription
+	nextSub     int
+	seen        map[string]Credential // profiles as subscribers last saw them
+	pending     [][]ProfileChange     // batches awaiting delivery
+	dispatching bool
+	refreshes   singleflight.Group
 }
 
-// DefaultStore loads from the default OpenClaw auth-profiles.json path.
+// StoreOption configures a Store.
+type StoreOption func(*Store)
+
+// WithLockTimeout sets how long writes wait for the cross-process lock file
+// before failing with a *LockTimeoutError.
+func WithLockTimeout(d time.Duration) StoreOption {
+	return func(s *Store) { s.lockTimeout = d }
+}
+
+// WithBackups sets how many previous generations of the store file are kept
+// as <path>.1, <path>.2, ... Zero disables backups. It only applies to stores
+// created with NewStore; configure other backends directly.
+func WithBackups(n int) StoreOption {
+	return func(s *Store) { s.backups = n }
+}
+
+// Errors returned by the profile management methods.
+var (
+	ErrProfileNotFound = errors.New("profile not found")
+	ErrProfileExists   = errors.New("profile already exists")
+)
+
+// errNoChange lets an update callback skip the save step.
+var errNoChange = errors.New("no change")
+
+// DefaultStore loads the store chosen by Discover for the working
+// directory: $AIAUTH_STORE, a project .aiauth.json or .aiauth/, or the
+// default OpenClaw auth-profiles.json path. Errors are dropped; use
+// OpenDefaultStore to see them.
 func DefaultStore() *Store {
-	home, err := os.UserHomeDir()
+	s, _ := OpenDefaultStore()
+	return s
+}
+
+// OpenDefaultStore is DefaultStore with options, applied after the profile
+// pins of a project file, that also returns any error from discovering or
+// loading the store, such as ErrKeyRequired for an encrypted store. The
+// store is non-nil even on error.
+func OpenDefaultStore(opts ...StoreOption) (*Store, error) {
+	cwd, _ := os.Getwd()
+	d, err := Discover(cwd)
 	if err != nil {
-		return &Store{path: "", data: &AuthStore{Version: 1, Profiles: make(map[string]*Credential)}}
+		// No home directory: fall back to an empty store without a backend.
+		return newStore(opts), err
 	}
-	p := filepath.Join(home, ".openclaw", "agents", "main", "agent", "auth-profiles.json")
-	s, _ := NewStore(p)
-	return s
+	s, err := NewStore(d.Path, append(d.Options(), opts...)...)
+	s.discovery = d
+	return s, err
 }
 
+// Discovery returns how DefaultStore chose this store, or nil for stores
+// opened explicitly.
+func (s *Store) Discovery() *Discovery { return s.discovery }
+
 // NewStore loads auth profiles from the given path.
-func NewStore(path string) (*Store, error) {
+func NewStore(path string, opts ...StoreOption) (*Store, error) {
+	s := newStore(opts)
+	s.path = path
+	s.backend = &FileBackend{Path: path, MaxBackups: s.backups}
+	return s, s.open()
+}
+
+// OpenStore loads auth profiles from an arbitrary backend.
+func OpenStore(b Backend, opts ...StoreOption) (*Store, error) {
+	s := newStore(opts)
+	s.backend = b
+	if fb, ok := b.(*FileBackend); ok {
+		s.path = fb.Path
+	}
+	return s, s.open()
+}
+
+func newStore(opts []StoreOption) *Store {
 	s := &Store{
-		path: path,
-		data: &AuthStore{Version: 1, Profiles: make(map[string]*Credential)},
+		writer:      make(chan struct{}, 1),
+		data:        &AuthStore{Version: SchemaVersion, Profiles: make(map[string]*Credential)},
+		lockTimeout: DefaultLockTimeout,
+		backups:     DefaultBackups,
 	}
-	if err := s.load(); err != nil && !os.IsNotExist(err) {
-		return s, err
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.secrets == nil {
+		s.secrets, s.secretsErr = secretBackendFromEnv()
+	}
+	s.policyErr = s.initPolicies()
+	return s
+}
+
+// open performs the initial load; a missing document is not an error.
+// An invalid resolution policy is reported after loading.
+func (s *Store) open() error {
+	if err := s.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
-	return s, nil
+	return s.policyErr
 }
 
-// Path returns the store file path.
+// Backend returns the storage backend.
+func (s *Store) Backend() Backend { return s.backend }
+
+// Path returns the store file path, or "" if the store is not file-backed.
 func (s *Store) Path() string { return s.path }
 
-// Profiles returns all profiles (not a copy — do not modify without lock).
+// Profiles returns a copy of all profiles keyed by name. Modifying the
+// returned credentials does not affect the store; use SetProfile.
 func (s *Store) Profiles() map[string]*Credential {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.data.Profiles
+	result := make(map[string]*Credential, len(s.data.Profiles))
+	for name, c := range s.data.Profiles {
+		cp := *c
+		result[name] = &cp
+	}
+	return result
+}
+
+// Profile returns a snapshot of the named profile.
+func (s *Store) Profile(name string) (NamedCredential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.data.Profiles[name]
+	if !ok {
+		return NamedCredential{}, false
+	}
+	return NamedCredential{name, *c}, true
+}
+
+// Snapshot returns snapshots of all profiles sorted by name.
+func (s *Store) Snapshot() []NamedCredential {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]NamedCredential, 0, len(s.data.Profiles))
+	for name, c := range s.data.Profiles {
+		result = append(result, NamedCredential{name, *c})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// All iterates over snapshots of all profiles sorted by name. The snapshot
+// is taken when iteration starts.
+func (s *Store) All() iter.Seq2[string, Credential] {
+	return func(yield func(string, Credential) bool) {
+		for _, nc := range s.Snapshot() {
+			if !yield(nc.Name, nc.Credential) {
+				return
+			}
+		}
+	}
 }
 
 // SetProfile adds or updates a profile and saves.
 func (s *Store) SetProfile(name string, cred *Credential) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		data.Profiles[name] = cred
+		return nil
+	})
+}
+
+// ProfilesForProvider returns snapshots of a provider's profiles in
+// resolution order (LastGood first, then by the policy's type order, then
+// name).
+func (s *Store) ProfilesForProvider(provider string) []NamedCredential {
+	return s.providerProfiles(provider)
+}
+
+// NamedCredential is a snapshot of a profile: a copy of its credential with
+// the profile name attached. Modifying it does not affect the store; write
+// back by name, which stays valid across reloads.
+type NamedCredential struct {
+	Name string
+	Credential
+}
+
+// providerProfiles returns the named profiles for a provider allowed by its
+// policy: pinned profiles in their configured order, otherwise the
+// provider's LastGood profile first, then by credential type order, then by
+// name.
+func (s *Store) providerProfiles(provider string) []NamedCredential {
+	policy := s.Policy(provider)
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.data.Profiles == nil {
-		s.data.Profiles = make(map[string]*Credential)
+
+	var result []NamedCredential
+	if len(policy.Profiles) > 0 {
+		for _, name := range policy.Profiles {
+			c := s.data.Profiles[name]
+			if c != nil && c.Provider == provider && policy.rank(c.Type) >= 0 {
+				result = append(result, NamedCredential{name, *c})
+			}
+		}
+		return result
+	}
+
+	for name, c := range s.data.Profiles {
+		if c.Provider != provider || policy.rank(c.Type) < 0 {
+			continue
+		}
+		result = append(result, NamedCredential{name, *c})
 	}
-	s.data.Profiles[name] = cred
-	return s.save()
+	lastGood := s.data.LastGood[provider]
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if (a.Name == lastGood) != (b.Name == lastGood) {
+			return a.Name == lastGood
+		}
+		if pa, pb := policy.rank(a.Type), policy.rank(b.Type); pa != pb {
+			return pa < pb
+		}
+		return a.Name < b.Name
+	})
+	return result
 }
 
-// ProfilesForProvider returns all credentials for a given provider, sorted by priority.
-func (s *Store) ProfilesForProvider(provider string) []*Credential {
+// excludedProfiles returns the provider's profiles that its policy rules
+// out, sorted by name.
+func (s *Store) excludedProfiles(provider string) []NamedCredential {
+	policy := s.Policy(provider)
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	var oauth, tokens, apiKeys []*Credential
-	for _, c := range s.data.Profiles {
+	var result []NamedCredential
+	for name, c := range s.data.Profiles {
 		if c.Provider != provider {
 			continue
 		}
-		switch c.Type {
-		case "oauth":
-			oauth = append(oauth, c)
-		case "token":
-			tokens = append(tokens, c)
-		case "api_key":
-			apiKeys = append(apiKeys, c)
+		if policy.rank(c.Type) < 0 || (len(policy.Profiles) > 0 && !slices.Contains(policy.Profiles, name)) {
+			result = append(result, NamedCredential{name, *c})
 		}
 	}
-	result := make([]*Credential, 0, len(oauth)+len(tokens)+len(apiKeys))
-	result = append(result, oauth...)
-	result = append(result, tokens...)
-	result = append(result, apiKeys...)
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
 	return result
 }
 
+// load reads the stored document and swaps it in. The caller must hold the
+// writer lock.
 func (s *Store) load() error {
-	data, err := os.ReadFile(s.path)
+	fresh, err := s.read()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(data, s.data)
+	s.mu.Lock()
+	s.data = fresh
+	s.mu.Unlock()
+	return nil
+}
+
+// read loads and decodes the stored document without touching s.data. The
+// caller must hold the writer lock, which also guards the key and secret
+// cache that decoding updates.
+func (s *Store) read() (*AuthStore, error) {
+	if s.backend == nil {
+		return nil, os.ErrNotExist
+	}
+	raw, err := s.backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(raw)
+}
+
+// lockWriter takes the in-process writer lock, waiting up to the lock
+// timeout or until ctx is done.
+func (s *Store) lockWriter(ctx context.Context) (unlock func(), err error) {
+	timer := time.NewTimer(s.timeout())
+	defer timer.Stop()
+	select {
+	case s.writer <- struct{}{}:
+		return func() { <-s.writer }, nil
+	case <-timer.C:
+		return nil, &LockTimeoutError{Path: "store writer", Timeout: s.timeout()}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Store) timeout() time.Duration {
+	if s.lockTimeout <= 0 {
+		return DefaultLockTimeout
+	}
+	return s.lockTimeout
 }
 
-func (s *Store) save() error {
-	data, err := json.MarshalIndent(s.data, "", "  ")
+// decode parses raw store JSON, decrypting secret fields if the store is
+// encrypted.
+func (s *Store) decode(raw []byte) (*AuthStore, error) {
+	raw, err := migrate(raw)
+	if err != nil {
+		return nil, err
+	}
+	fresh := &AuthStore{}
+	if err := json.Unmarshal(raw, fresh); err != nil {
+		return nil, err
+	}
+	if fresh.Profiles == nil {
+		fresh.Profiles = make(map[string]*Credential)
+	}
+	if fresh.Encryption != nil {
+		key, err := s.unlock(fresh.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		if err := openProfiles(key, fresh.Profiles); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.loadSecrets(fresh); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// unlock returns the key for enc, deriving it from the configured key source
+// (or the AIAUTH_PASSPHRASE / AIAUTH_KEY_FILE env vars) on first use.
+func (s *Store) unlock(enc *Encryption) ([]byte, error) {
+	if s.key != nil && s.keySalt == enc.Salt {
+		return s.key, nil
+	}
+	src := s.keySource
+	if src.empty() {
+		src = keySourceFromEnv()
+	}
+	key, err := enc.unlock(src)
+	if err != nil {
+		return nil, err
+	}
+	s.key, s.keySalt = key, enc.Salt
+	return key, nil
+}
+
+// save writes doc. Unless backup is set, a backend that keeps backups
+// replaces the current generation instead of rotating it out. The caller
+// must hold the writer lock.
+func (s *Store) save(doc *AuthStore, backup bool) error {
+	if doc.Version > SchemaVersion {
+		return &SchemaVersionError{Version: doc.Version, Supported: SchemaVersion}
+	}
+	profiles := doc.Profiles
+	var err error
+	var live map[string]string
+	if s.secrets != nil {
+		if profiles, live, err = s.storeSecrets(doc); err != nil {
+			return err
+		}
+	}
+	if doc.Encryption != nil {
+		if profiles, err = sealProfiles(s.key, profiles); err != nil {
+			return err
+		}
+	}
+	out := *doc
+	out.Profiles = profiles
+	data, err := json.MarshalIndent(&out, "", "  ")
 	if err != nil {
 		return err
 	}
-	dir := filepath.Dir(s.path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	write := s.backend.Save
+	if bb, ok := s.backend.(BackupBackend); ok && !backup {
+		write = bb.SaveWithoutBackup
+	}
+	if s.secrets == nil {
+		return write(data)
+	}
+
+	prior, ok := s.backupSecretRefs()
+	if err := write(data); err != nil {
 		return err
 	}
-	return os.WriteFile(s.path, data, 0600)
+	unused := s.secretCache
+	s.secretCache = live
+	if !ok {
+		return nil
+	}
+	for key := range unused {
+		prior[key] = true
+	}
+	return s.pruneSecrets(prior, live)
 }
 
-// Reload re-reads the store from disk.
-func (s *Store) Reload() error {
+// update runs a load-modify-save cycle while holding both the in-process
+// writer lock and the backend's cross-process lock, so concurrent writers
+// never overwrite each other's changes. fn works on a private copy of the
+// document, which is swapped in once saved, so readers are not held up by a
+// slow fn such as a token refresh. If fn returns errNoChange the save is
+// skipped and update returns nil. Subscribers are notified of any profile
+// changes, including ones made by other writers that the reload picked up.
+func (s *Store) update(ctx context.Context, fn func(data *AuthStore) error) error {
+	err := s.commit(ctx, fn)
+	s.notify()
+	return err
+}
+
+func (s *Store) commit(ctx context.Context, fn func(data *AuthStore) error) error {
+	if s.backend == nil {
+		return fmt.Errorf("store has no backend")
+	}
+	unlockWriter, err := s.lockWriter(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlockWriter()
+	unlock, err := s.backend.Lock(ctx, s.timeout())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	doc, err := s.read()
+	if errors.Is(err, os.ErrNotExist) {
+		doc, err = &AuthStore{Version: SchemaVersion, Profiles: make(map[string]*Credential)}, nil
+	}
+	if err != nil {
+		return err
+	}
+	before, enc := snapshotProfiles(doc.Profiles), doc.Encryption
+	if err := fn(doc); err != nil {
+		if !errors.Is(err, errNoChange) {
+			return err
+		}
+	} else {
+		// Bookkeeping such as usage stats and lastGood is not worth a
+		// backup generation; rotating for it would push out the real ones.
+		backup := doc.Encryption != enc || len(diffProfiles(before, doc.Profiles)) > 0
+		if err := s.save(doc, backup); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.data = doc
+	s.mu.Unlock()
+	return nil
+}
+
+// Backups lists the previous generations kept by the backend, if any.
+func (s *Store) Backups() ([]Backup, error) {
+	bb, ok := s.backend.(BackupBackend)
+	if !ok {
+		return nil, nil
+	}
+	return bb.Backups()
+}
+
+// Restore rolls the store back to backup generation n (1 = most recent).
+// The current contents are rotated into the backups like any other save, so
+// a restore can itself be undone.
+func (s *Store) Restore(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid backup generation %d", n)
+	}
+	bb, ok := s.backend.(BackupBackend)
+	if !ok {
+		return fmt.Errorf("store backend does not keep backups")
+	}
+	return s.update(context.Background(), func(data *AuthStore) error {
+		raw, err := bb.LoadBackup(n)
+		if err != nil {
+			return fmt.Errorf("read backup %d: %w", n, err)
+		}
+		restored, err := s.decode(raw)
+		if err != nil {
+			return fmt.Errorf("backup %d is not a readable store: %w", n, err)
+		}
+		*data = *restored
+		return nil
+	})
+}
+
+// Encrypted reports whether the store is saved in the encrypted format.
+func (s *Store) Encrypted() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.load()
+	return s.data.Encryption != nil
+}
+
+// Encrypt converts the store to the encrypted format: secret credential
+// fields are sealed with a key derived from src, everything else stays
+// readable. The same key source is needed to open the store afterwards.
+func (s *Store) Encrypt(src KeySource) error {
+	err := s.update(context.Background(), func(data *AuthStore) error {
+		if data.Encryption != nil {
+			return fmt.Errorf("store is already encrypted")
+		}
+		enc, key, err := newEncryption(src)
+		if err != nil {
+			return err
+		}
+		data.Encryption = enc
+		s.keySource = src
+		s.key, s.keySalt = key, enc.Salt
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Older generations still hold the secrets in plaintext.
+	if bb, ok := s.backend.(BackupBackend); ok {
+		if err := bb.RemoveBackups(); err != nil {
+			return fmt.Errorf("remove plaintext backups: %w", err)
+		}
+	}
+	return nil
+}
+
+// Decrypt converts an encrypted store back to plaintext. The store must
+// have been opened with the right key.
+func (s *Store) Decrypt() error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		if data.Encryption == nil {
+			return fmt.Errorf("store is not encrypted")
+		}
+		data.Encryption = nil
+		return nil
+	})
+}
+
+// Reload re-reads the store from disk and notifies subscribers of any
+// changes. On error the previous contents are kept.
+func (s *Store) Reload() error {
+	unlock, err := s.lockWriter(context.Background())
+	if err != nil {
+		return err
+	}
+	err = s.load()
+	unlock()
+	s.notify()
+	return err
 }
 
 // UpdateProfile updates a profile in-place and saves. Thread-safe.
 func (s *Store) UpdateProfile(name string, cred *Credential) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data.Profiles[name] = cred
-	return s.save()
+	return s.update(context.Background(), func(data *AuthStore) error {
+		data.Profiles[name] = cred
+		return nil
+	})
+}
+
+// AddProfile adds a profile and saves, failing with ErrProfileExists if the
+// name is taken.
+func (s *Store) AddProfile(name string, cred *Credential) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		if _, ok := data.Profiles[name]; ok {
+			return fmt.Errorf("%w: %q", ErrProfileExists, name)
+		}
+		data.Profiles[name] = cred
+		return nil
+	})
+}
+
+// DeleteProfile removes a profile along with its usage stats and any
+// LastGood entry pointing at it.
+func (s *Store) DeleteProfile(name string) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		if _, ok := data.Profiles[name]; !ok {
+			return fmt.Errorf("%w: %q", ErrProfileNotFound, name)
+		}
+		delete(data.Profiles, name)
+		delete(data.UsageStats, name)
+		for provider, lg := range data.LastGood {
+			if lg == name {
+				delete(data.LastGood, provider)
+			}
+		}
+		return nil
+	})
+}
+
+// RenameProfile renames a profile, carrying its usage stats and LastGood
+// entries over to the new name.
+func (s *Store) RenameProfile(oldName, newName string) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		c, ok := data.Profiles[oldName]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrProfileNotFound, oldName)
+		}
+		if _, ok := data.Profiles[newName]; ok {
+			return fmt.Errorf("%w: %q", ErrProfileExists, newName)
+		}
+		delete(data.Profiles, oldName)
+		data.Profiles[newName] = c
+		if st, ok := data.UsageStats[oldName]; ok {
+			delete(data.UsageStats, oldName)
+			data.UsageStats[newName] = st
+		}
+		for provider, lg := range data.LastGood {
+			if lg == oldName {
+				data.LastGood[provider] = newName
+			}
+		}
+		return nil
+	})
 }
 
-// FindProfileName returns the profile name for a credential pointer.
-func (s *Store) FindProfileName(cred *Credential) string {
+// CopyProfile copies a profile's credential to a new name. The copy starts
+// with no usage stats and does not become LastGood.
+func (s *Store) CopyProfile(src, dst string) error {
+	return s.update(context.Background(), func(data *AuthStore) error {
+		c, ok := data.Profiles[src]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrProfileNotFound, src)
+		}
+		if _, ok := data.Profiles[dst]; ok {
+			return fmt.Errorf("%w: %q", ErrProfileExists, dst)
+		}
+		cp := *c
+		data.Profiles[dst] = &cp
+		return nil
+	})
+}
+
+// Usage returns a copy of a profile's usage stats.
+func (s *Store) Usage(name string) UsageStats {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	for name, c := range s.data.Profiles {
-		if c == cred {
-			return name
-		}
+	st := s.data.UsageStats[name]
+	if st == nil {
+		return UsageStats{}
 	}
-	return fmt.Sprintf("%s:unknown", cred.Provider)
+	cp := *st
+	cp.FailureCounts = maps.Clone(st.FailureCounts)
+	return cp
 }
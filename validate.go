@@ -0,0 +1,264 @@
+package aiauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity ranks a validation finding.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // the profile or store is unusable or unsafe
+	SeverityWarning Severity = "warning" // likely a mistake, but resolution still works
+)
+
+// Finding is one problem reported by Validate.
+type Finding struct {
+	Check    string // stable identifier of the check, e.g. "lastgood-missing"
+	Severity Severity
+	Profile  string // affected profile; empty for store-wide findings
+	Path     string // affected file, for permission findings
+	Message  string
+	Fixable  bool // Fix can repair it
+}
+
+func (f Finding) String() string {
+	subject := f.Profile
+	if subject == "" {
+		subject = f.Path
+	}
+	if subject == "" {
+		return fmt.Sprintf("%s: %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Severity, subject, f.Message)
+}
+
+// Validate checks the store for inconsistencies and unsafe settings and
+// returns its findings, errors first.
+func (s *Store) Validate() []Finding {
+	s.mu.Lock()
+	findings := validateData(s.data, time.Now())
+	s.mu.Unlock()
+
+	for _, provider := range s.pinnedProviders() {
+		for _, name := range s.Policy(provider).Profiles {
+			if _, ok := s.Profile(name); !ok {
+				findings = append(findings, Finding{
+					Check: "pinned-missing", Severity: SeverityWarning, Profile: name,
+					Message: fmt.Sprintf("pinned for %s by policy but does not exist", provider),
+				})
+			}
+		}
+	}
+	if fb, ok := s.backend.(*FileBackend); ok {
+		findings = append(findings, filePermissionFindings(fb)...)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity == SeverityError && findings[j].Severity != SeverityError
+	})
+	return findings
+}
+
+// Fix repairs every fixable finding: dangling LastGood and usage entries
+// are removed and store files are made private. It returns the findings it
+// fixed.
+func (s *Store) Fix() ([]Finding, error) {
+	var fixed []Finding
+	err := s.update(context.Background(), func(data *AuthStore) error {
+		fixed = fixed[:0]
+		for _, f := range validateData(data, time.Now()) {
+			if !f.Fixable {
+				continue
+			}
+			switch f.Check {
+			case "lastgood-missing", "lastgood-provider":
+				for provider, name := range data.LastGood {
+					if name == f.Profile {
+						delete(data.LastGood, provider)
+					}
+				}
+			case "usage-orphan":
+				delete(data.UsageStats, f.Profile)
+			default:
+				continue
+			}
+			fixed = append(fixed, f)
+		}
+		if len(fixed) == 0 {
+			return errNoChange
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if fb, ok := s.backend.(*FileBackend); ok {
+		for _, f := range filePermissionFindings(fb) {
+			if err := os.Chmod(f.Path, 0600); err != nil {
+				return fixed, err
+			}
+			fixed = append(fixed, f)
+		}
+	}
+	return fixed, nil
+}
+
+// validateData checks the document itself.
+func validateData(data *AuthStore, now time.Time) []Finding {
+	var findings []Finding
+	add := func(f Finding) { findings = append(findings, f) }
+
+	names := make([]string, 0, len(data.Profiles))
+	for name := range data.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := data.Profiles[name]
+		if prefix, _, ok := strings.Cut(name, ":"); ok && prefix != c.Provider {
+			add(Finding{Check: "provider-mismatch", Severity: SeverityWarning, Profile: name,
+				Message: fmt.Sprintf("name suggests provider %q but the profile is for %q", prefix, c.Provider)})
+		}
+		if c.Provider == "" {
+			add(Finding{Check: "no-provider", Severity: SeverityError, Profile: name, Message: "no provider set"})
+		}
+		if c.Provider == "azure" && c.Endpoint == "" {
+			add(Finding{Check: "no-endpoint", Severity: SeverityWarning, Profile: name,
+				Message: "azure profile has no endpoint; callers must know the resource URL"})
+		}
+		switch c.Type {
+		case "oauth":
+			if c.Access == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "oauth profile has no access token"})
+			}
+			if c.Refresh == "" {
+				add(Finding{Check: "oauth-no-refresh", Severity: SeverityWarning, Profile: name,
+					Message: "oauth profile has no refresh token; it stops working when the access token expires"})
+			}
+		case "token":
+			if c.Token == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "token profile has no token"})
+			} else if c.Expires > 0 && c.Expires < now.UnixMilli() {
+				add(Finding{Check: "expired", Severity: SeverityWarning, Profile: name,
+					Message: "token expired " + time.UnixMilli(c.Expires).Format(time.RFC3339)})
+			}
+		case "service_account":
+			if c.ServiceAccount == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "service_account profile has no key"})
+			} else if !json.Valid([]byte(c.ServiceAccount)) {
+				add(Finding{Check: "invalid-key", Severity: SeverityError, Profile: name, Message: "service account key is not valid JSON"})
+			}
+		case "client_credentials":
+			if c.ClientID == "" || c.ClientSecret == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "client_credentials profile has no client id or secret"})
+			}
+			if c.TenantID == "" {
+				add(Finding{Check: "no-tenant", Severity: SeverityError, Profile: name, Message: "client_credentials profile has no tenant"})
+			}
+		case "aws":
+			if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "aws profile has no access key"})
+			} else if c.Expires > 0 && c.Expires < now.UnixMilli() {
+				add(Finding{Check: "expired", Severity: SeverityWarning, Profile: name,
+					Message: "session credentials expired " + time.UnixMilli(c.Expires).Format(time.RFC3339)})
+			}
+		case "api_key":
+			if c.Key == "" {
+				add(Finding{Check: "empty-secret", Severity: SeverityError, Profile: name, Message: "api_key profile has no key"})
+			}
+		default:
+			add(Finding{Check: "unknown-type", Severity: SeverityWarning, Profile: name,
+				Message: fmt.Sprintf("unknown credential type %q is never used", c.Type)})
+		}
+	}
+
+	providers := make([]string, 0, len(data.LastGood))
+	for provider := range data.LastGood {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	for _, provider := range providers {
+		name := data.LastGood[provider]
+		c, ok := data.Profiles[name]
+		switch {
+		case !ok:
+			add(Finding{Check: "lastgood-missing", Severity: SeverityError, Profile: name, Fixable: true,
+				Message: fmt.Sprintf("lastGood for %s points at a missing profile", provider)})
+		case c.Provider != provider:
+			add(Finding{Check: "lastgood-provider", Severity: SeverityError, Profile: name, Fixable: true,
+				Message: fmt.Sprintf("lastGood for %s points at a %s profile", provider, c.Provider)})
+		}
+	}
+
+	var orphans []string
+	for name := range data.UsageStats {
+		if _, ok := data.Profiles[name]; !ok {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		add(Finding{Check: "usage-orphan", Severity: SeverityWarning, Profile: name, Fixable: true,
+			Message: "usage stats for a missing profile"})
+	}
+	return findings
+}
+
+// filePermissionFindings reports store files that other users can access.
+func filePermissionFindings(fb *FileBackend) []Finding {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	paths := []string{fb.Path}
+	if backups, err := fb.Backups(); err == nil {
+		for _, b := range backups {
+			paths = append(paths, b.Path)
+		}
+	}
+	var findings []Finding
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || info.Mode().Perm()&0077 == 0 {
+			continue
+		}
+		findings = append(findings, Finding{Check: "file-permissions", Severity: SeverityError, Path: p, Fixable: true,
+			Message: fmt.Sprintf("mode %04o lets other users read credentials; want 0600", info.Mode().Perm())})
+	}
+	return findings
+}
+
+// pinnedProviders returns the providers whose policy pins profiles.
+func (s *Store) pinnedProviders() []string {
+	seen := make(map[string]bool)
+	for provider := range s.pins {
+		seen[provider] = true
+	}
+	for provider, p := range s.policies {
+		if len(p.Profiles) > 0 {
+			seen[provider] = true
+		}
+	}
+	if s.config != nil {
+		for provider, p := range s.config.Providers {
+			if len(p.Profiles) > 0 {
+				seen[provider] = true
+			}
+		}
+	}
+	providers := make([]string, 0, len(seen))
+	for provider := range seen {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
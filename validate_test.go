@@ -0,0 +1,66 @@
+package aiauth
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestValidateAndFix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	data := &AuthStore{
+		Version: 1,
+		Profiles: map[string]*Credential{
+			"anthropic:oa": {Type: "oauth", Provider: "anthropic", Access: "a"},
+			"openai:key":   {Type: "api_key", Provider: "anthropic", Key: "k"},
+			"anthropic:x":  {Type: "api_key", Provider: "anthropic"},
+			"vertex:sa":    {Type: "service_account", Provider: "vertex", ServiceAccount: "{not json"},
+		},
+		LastGood:   map[string]string{"anthropic": "anthropic:gone", "openai": "anthropic:oa"},
+		UsageStats: map[string]*UsageStats{"anthropic:gone": {LastUsed: 1}},
+	}
+	raw, _ := json.Marshal(data)
+	os.WriteFile(path, raw, 0644)
+
+	store, _ := NewStore(path)
+	checks := map[string]Finding{}
+	for _, f := range store.Validate() {
+		checks[f.Check+" "+f.Profile+f.Path] = f
+	}
+	for _, want := range []string{
+		"oauth-no-refresh anthropic:oa",
+		"provider-mismatch openai:key",
+		"empty-secret anthropic:x",
+		"invalid-key vertex:sa",
+		"lastgood-missing anthropic:gone",
+		"lastgood-provider anthropic:oa",
+		"usage-orphan anthropic:gone",
+	} {
+		if _, ok := checks[want]; !ok {
+			t.Errorf("missing finding %q in %v", want, checks)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if _, ok := checks["file-permissions "+path]; !ok {
+			t.Errorf("missing permission finding in %v", checks)
+		}
+	}
+
+	fixed, err := store.Fix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixed) < 3 {
+		t.Fatalf("expected at least 3 fixes, got %v", fixed)
+	}
+	for _, f := range store.Validate() {
+		if f.Fixable {
+			t.Errorf("fixable finding left after Fix: %s", f)
+		}
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("expected 0600, got %04o", info.Mode().Perm())
+	}
+}
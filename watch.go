@@ -0,0 +1,137 @@
+package aiauth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// ChangeKind says how a profile changed.
+type ChangeKind string
+
+const (
+	ProfileAdded   ChangeKind = "added"
+	ProfileUpdated ChangeKind = "updated"
+	ProfileRemoved ChangeKind = "removed"
+)
+
+// ProfileChange describes one profile that changed between two versions of
+// the store. Old is nil for added profiles and New for removed ones.
+type ProfileChange struct {
+	Name string
+	Kind ChangeKind
+	Old  *Credential
+	New  *Credential
+}
+
+type subscription struct {
+	id int
+	fn func([]ProfileChange)
+}
+
+// Subscribe registers fn to be called with the profiles that changed
+// whenever the store's contents change, whether by a write through this
+// Store or by a reload that picked up another process's write (see Watch).
+// Callbacks run one batch at a time in order, possibly on the goroutine
+// that made the change; they may use the store. The returned function
+// unsubscribes.
+func (s *Store) Subscribe(fn func([]ProfileChange)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subs) == 0 {
+		s.seen = snapshotProfiles(s.data.Profiles)
+	}
+	s.nextSub++
+	id := s.nextSub
+	s.subs = append(s.subs, subscription{id, fn})
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, sub := range s.subs {
+			if sub.id == id {
+				s.subs = append(s.subs[:i:i], s.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Watch reloads the store whenever the backend reports an external change
+// and notifies subscribers, until ctx is done. Writes through a Store always
+// re-read the backend under its lock first, so a reload never loses data; a
+// reload that fails (for example on a file written in place by another tool
+// and caught half-written) keeps the previous contents and is retried on the
+// next change.
+func (s *Store) Watch(ctx context.Context) error {
+	if s.backend == nil {
+		return fmt.Errorf("store has no backend")
+	}
+	return s.backend.Watch(ctx, func() { _ = s.Reload() })
+}
+
+// StartWatch runs Watch in a goroutine until ctx is done.
+func (s *Store) StartWatch(ctx context.Context) {
+	go s.Watch(ctx)
+}
+
+// notify diffs the profiles against what subscribers last saw and delivers
+// the changes. Deliveries are serialized: if another goroutine (or a
+// callback calling back into the store) is already delivering, the batch is
+// queued for it instead.
+func (s *Store) notify() {
+	s.mu.Lock()
+	if len(s.subs) > 0 {
+		if changes := diffProfiles(s.seen, s.data.Profiles); len(changes) > 0 {
+			s.pending = append(s.pending, changes)
+			s.seen = snapshotProfiles(s.data.Profiles)
+		}
+	}
+	if s.dispatching {
+		s.mu.Unlock()
+		return
+	}
+	s.dispatching = true
+	for len(s.pending) > 0 {
+		batch := s.pending[0]
+		s.pending = s.pending[1:]
+		subs := append([]subscription(nil), s.subs...)
+		s.mu.Unlock()
+		for _, sub := range subs {
+			sub.fn(batch)
+		}
+		s.mu.Lock()
+	}
+	s.dispatching = false
+	s.mu.Unlock()
+}
+
+func snapshotProfiles(profiles map[string]*Credential) map[string]Credential {
+	seen := make(map[string]Credential, len(profiles))
+	for name, c := range profiles {
+		seen[name] = *c
+	}
+	return seen
+}
+
+// diffProfiles returns the changes from old to cur, sorted by name.
+func diffProfiles(old map[string]Credential, cur map[string]*Credential) []ProfileChange {
+	var changes []ProfileChange
+	for name, c := range cur {
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			n := *c
+			changes = append(changes, ProfileChange{Name: name, Kind: ProfileAdded, New: &n})
+		case prev != *c:
+			n := *c
+			changes = append(changes, ProfileChange{Name: name, Kind: ProfileUpdated, Old: &prev, New: &n})
+		}
+	}
+	for name, prev := range old {
+		if _, ok := cur[name]; !ok {
+			changes = append(changes, ProfileChange{Name: name, Kind: ProfileRemoved, Old: &prev})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
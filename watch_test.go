@@ -0,0 +1,59 @@
+package aiauth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchReloadsExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth-profiles.json")
+	s1, _ := NewStore(path)
+	s1.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+
+	changes := make(chan []ProfileChange, 10)
+	unsubscribe := s1.Subscribe(func(c []ProfileChange) { changes <- c })
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s1.StartWatch(ctx)
+	time.Sleep(50 * time.Millisecond) // let the watch start
+
+	s2, _ := NewStore(path)
+	s2.SetProfile("anthropic:b", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-b"})
+
+	select {
+	case c := <-changes:
+		if len(c) != 1 || c[0].Name != "anthropic:b" || c[0].Kind != ProfileAdded || c[0].New.Key != "key-b" {
+			t.Fatalf("unexpected changes %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("external change was not picked up")
+	}
+	if c, ok := s1.Profile("anthropic:b"); !ok || c.Key != "key-b" {
+		t.Fatal("store was not reloaded")
+	}
+}
+
+func TestSubscribeLocalWrites(t *testing.T) {
+	store, _ := OpenStore(NewMemoryBackend())
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a"})
+
+	var got []ProfileChange
+	store.Subscribe(func(c []ProfileChange) {
+		got = append(got, c...)
+		// Callbacks may write to the store; the change is delivered next.
+		if c[0].Name == "anthropic:a" && c[0].Kind == ProfileUpdated {
+			store.DeleteProfile("anthropic:a")
+		}
+	})
+
+	store.SetProfile("anthropic:a", &Credential{Type: "api_key", Provider: "anthropic", Key: "key-a2"})
+	store.ReportFailure("anthropic:missing", FailureAuth) // no profile change
+
+	if len(got) != 2 || got[0].Kind != ProfileUpdated || got[0].Old.Key != "key-a" || got[1].Kind != ProfileRemoved {
+		t.Fatalf("unexpected changes %+v", got)
+	}
+}